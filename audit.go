@@ -0,0 +1,113 @@
+package tesla
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// AuditEntry records a single command sent, or attempted, to a vehicle
+type AuditEntry struct {
+	Timestamp time.Time              `json:"timestamp"`
+	User      string                 `json:"user"`
+	VehicleID int64                  `json:"vehicle_id"`
+	Vin       string                 `json:"vin"`
+	Command   string                 `json:"command"`
+	Args      map[string]interface{} `json:"args,omitempty"`
+	Result    bool                   `json:"result"`
+	Reason    string                 `json:"reason,omitempty"`
+	Latency   time.Duration          `json:"latency_ns"`
+}
+
+// AuditSink receives audit entries for commands sent to vehicles
+type AuditSink interface {
+	Record(entry *AuditEntry) error
+}
+
+// FileAuditSink appends audit entries to a file as JSON lines
+type FileAuditSink struct {
+	file *os.File
+	mu   sync.Mutex
+}
+
+// redactedArgs are the command arguments that are never written to an audit entry
+var redactedArgs = map[string]bool{
+	"password": true,
+}
+
+// NewFileAuditSink opens, or creates, the file at the given path for appending audit entries
+func NewFileAuditSink(path string) (*FileAuditSink, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileAuditSink{file: file}, nil
+}
+
+// Record writes the entry as a single line of JSON
+func (s *FileAuditSink) Record(entry *AuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.file.Write(append(line, '\n'))
+	return err
+}
+
+// Close closes the underlying file
+func (s *FileAuditSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// newAuditEntry builds the audit entry for a command from its payload and outcome
+func newAuditEntry(v Vehicle, cmd Command, payload interface{}, body []byte, err error, start time.Time) *AuditEntry {
+	entry := &AuditEntry{
+		Timestamp: start,
+		VehicleID: v.ID,
+		Vin:       v.Vin,
+		Command:   cmd.Name,
+		Args:      sanitizeArgs(payload),
+		Latency:   time.Since(start),
+	}
+	if ActiveClient.Auth != nil {
+		entry.User = ActiveClient.Auth.Email
+	}
+	if err != nil {
+		entry.Reason = err.Error()
+		return entry
+	}
+	response, err := parseCommandResponse(body)
+	if err != nil {
+		entry.Reason = err.Error()
+		return entry
+	}
+	entry.Result = response.Response.Result
+	entry.Reason = response.Response.Reason
+	return entry
+}
+
+// sanitizeArgs converts a payload to its JSON arguments with sensitive values redacted
+func sanitizeArgs(payload interface{}) map[string]interface{} {
+	if payload == nil {
+		return nil
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil
+	}
+	args := map[string]interface{}{}
+	if err := json.Unmarshal(data, &args); err != nil {
+		return nil
+	}
+	for name := range args {
+		if redactedArgs[name] {
+			args[name] = "[REDACTED]"
+		}
+	}
+	return args
+}
@@ -0,0 +1,87 @@
+package tesla
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAudit(t *testing.T) {
+	ts := serveHTTP(t)
+	defer ts.Close()
+	previousURL := BaseURL
+	BaseURL = ts.URL + "/api/1"
+
+	dir, err := ioutil.TempDir("", "audit")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.jsonl")
+	sink, err := NewFileAuditSink(path)
+	assert.Nil(t, err)
+
+	auth := &Auth{
+		GrantType:    "password",
+		ClientID:     "someclient123",
+		ClientSecret: "somesecret456",
+		Email:        "nobody@example.com",
+		Password:     "pass",
+	}
+	client, _ := NewClient(auth)
+	client.Audit = sink
+	vehicles, err := client.Vehicles()
+	assert.Nil(t, err)
+	vehicle := vehicles[0]
+
+	assert.Nil(t, vehicle.LockDoors())
+	assert.Nil(t, vehicle.Start("pass"))
+	assert.NotNil(t, vehicle.SetChargeLimitStandard())
+	assert.NotNil(t, vehicle.SetChargeLimit(10))
+	assert.Nil(t, sink.Close())
+
+	file, err := os.Open(path)
+	assert.Nil(t, err)
+	defer file.Close()
+	var entries []*AuditEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		entry := &AuditEntry{}
+		assert.Nil(t, json.Unmarshal(scanner.Bytes(), entry))
+		entries = append(entries, entry)
+	}
+	assert.Len(t, entries, 4)
+
+	assert.Equal(t, "door_lock", entries[0].Command)
+	assert.Equal(t, int64(123), entries[0].VehicleID)
+	assert.Equal(t, "abc123", entries[0].Vin)
+	assert.Equal(t, "nobody@example.com", entries[0].User)
+	assert.True(t, entries[0].Result)
+	assert.Nil(t, entries[0].Args)
+	assert.False(t, entries[0].Timestamp.IsZero())
+
+	assert.Equal(t, "remote_start_drive", entries[1].Command)
+	assert.Equal(t, "[REDACTED]", entries[1].Args["password"])
+
+	assert.Equal(t, "charge_standard", entries[2].Command)
+	assert.False(t, entries[2].Result)
+	assert.Equal(t, "already_standard", entries[2].Reason)
+
+	assert.Equal(t, "set_charge_limit", entries[3].Command)
+	assert.Equal(t, 10.0, entries[3].Args["percent"])
+	assert.Equal(t, "charge limit 10 outside of allowed range 50-100", entries[3].Reason)
+
+	// a sink that fails after the command was sent doesn't fail the command
+	var logged bytes.Buffer
+	client.Logger = log.New(&logged, "", 0)
+	client.Audit = sink
+	assert.Nil(t, vehicle.LockDoors())
+	assert.Contains(t, logged.String(), `command "door_lock" not audited`)
+
+	BaseURL = previousURL
+}
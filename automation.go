@@ -0,0 +1,356 @@
+package tesla
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Automation is a set of rules and the geofences they refer to, as loaded from
+// a YAML or JSON file
+type Automation struct {
+	Geofences []*Geofence       `json:"geofences,omitempty"`
+	Rules     []*AutomationRule `json:"rules"`
+}
+
+// AutomationRule runs its actions when every condition holds. Rules with a
+// schedule run at each time the schedule fires while their conditions hold;
+// rules without one run once each time their conditions start to hold.
+type AutomationRule struct {
+	Name string `json:"name"`
+	// Schedule is a cron schedule, see ParseSchedule
+	Schedule string `json:"schedule,omitempty"`
+	// TimeZone the schedule is evaluated in; defaults to the local time zone
+	TimeZone   string                `json:"time_zone,omitempty"`
+	Conditions []AutomationCondition `json:"conditions,omitempty"`
+	// Inside and Outside name geofences the vehicle must be inside or outside of
+	Inside  []string           `json:"inside,omitempty"`
+	Outside []string           `json:"outside,omitempty"`
+	Actions []AutomationAction `json:"actions"`
+
+	schedule *Schedule
+	location *time.Location
+}
+
+// AutomationCondition compares a state field, named as in Change, with a value.
+// Op is one of ==, !=, <, <=, > and >=. Conditions on states that have not been
+// read do not hold.
+type AutomationCondition struct {
+	Field string      `json:"field"`
+	Op    string      `json:"op"`
+	Value interface{} `json:"value"`
+}
+
+// AutomationAction either sends a command, as with Vehicle.Execute, or passes a
+// message to the engine's Notify function
+type AutomationAction struct {
+	Command string                 `json:"command,omitempty"`
+	Args    map[string]interface{} `json:"args,omitempty"`
+	Notify  string                 `json:"notify,omitempty"`
+}
+
+// AutomationResult is the outcome of an action run by the automation engine
+type AutomationResult struct {
+	Rule   string
+	Action AutomationAction
+	Time   time.Time
+	// DryRun is set when the action was not run because the engine is in dry run mode
+	DryRun   bool
+	Response *CommandResponse
+	Err      error
+}
+
+// AutomationOptions configures an automation engine
+type AutomationOptions struct {
+	// DryRun evaluates rules and reports the actions they would run without running them
+	DryRun bool
+	// Notify receives the messages of notify actions
+	Notify func(rule string, message string)
+	// Geofences configures the monitoring of the automation's geofences
+	Geofences *GeofenceOptions
+}
+
+// AutomationEngine evaluates an automation's rules against the states of a
+// single vehicle. States missing from a snapshot keep their last known value.
+type AutomationEngine struct {
+	vehicle  Vehicle
+	rules    []*AutomationRule
+	opts     AutomationOptions
+	monitor  *GeofenceMonitor
+	state    StateSnapshot
+	holding  map[string]bool
+	lastEval time.Time
+}
+
+var conditionOps = map[string]bool{"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true}
+
+// LoadAutomation reads an automation from the YAML or JSON file at the given path
+func LoadAutomation(path string) (*Automation, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseAutomation(data)
+}
+
+// ParseAutomation parses and validates an automation written in YAML or JSON
+func ParseAutomation(data []byte) (*Automation, error) {
+	// YAML is a superset of JSON; decoding generically and converting to JSON
+	// lets both formats share the JSON field names
+	var document interface{}
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+	automation := &Automation{}
+	if err = json.Unmarshal(data, automation); err != nil {
+		return nil, err
+	}
+	if err = automation.check(); err != nil {
+		return nil, err
+	}
+	return automation, nil
+}
+
+// check validates the automation's geofences and rules, and parses their schedules
+func (a *Automation) check() error {
+	fences := map[string]bool{}
+	for _, fence := range a.Geofences {
+		if err := fence.check(); err != nil {
+			return err
+		}
+		fences[fence.Name] = true
+	}
+	names := map[string]bool{}
+	for _, rule := range a.Rules {
+		if names[rule.Name] {
+			return fmt.Errorf("duplicate automation rule %q", rule.Name)
+		}
+		names[rule.Name] = true
+		if err := rule.check(fences); err != nil {
+			return fmt.Errorf("automation rule %q: %v", rule.Name, err)
+		}
+	}
+	return nil
+}
+
+func (r *AutomationRule) check(fences map[string]bool) error {
+	if r.Schedule != "" {
+		schedule, err := ParseSchedule(r.Schedule)
+		if err != nil {
+			return err
+		}
+		r.schedule = schedule
+	}
+	r.location = time.Local
+	if r.TimeZone != "" {
+		location, err := time.LoadLocation(r.TimeZone)
+		if err != nil {
+			return err
+		}
+		r.location = location
+	}
+
+	// every state is present in the zero snapshot, so only unknown fields are missing
+	all := &StateSnapshot{&ChargeState{}, &ClimateState{}, &DriveState{}, &VehicleState{}}
+	for _, condition := range r.Conditions {
+		if _, ok := all.field(condition.Field); !ok {
+			return fmt.Errorf("unknown field %q", condition.Field)
+		}
+		if !conditionOps[condition.Op] {
+			return fmt.Errorf("unknown operator %q", condition.Op)
+		}
+	}
+	for _, name := range append(append([]string{}, r.Inside...), r.Outside...) {
+		if !fences[name] {
+			return fmt.Errorf("unknown geofence %q", name)
+		}
+	}
+	if len(r.Actions) == 0 {
+		return errors.New("no actions")
+	}
+	for _, action := range r.Actions {
+		if (action.Command == "") == (action.Notify == "") {
+			return errors.New("actions need either a command or a notify message")
+		}
+		if action.Command == "" {
+			continue
+		}
+		cmd, ok := LookupCommand(action.Command)
+		if !ok {
+			return fmt.Errorf("unknown command %q", action.Command)
+		}
+		if _, err := cmd.decode(action.Args); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewAutomationEngine creates an engine running the automation's rules for the vehicle
+func NewAutomationEngine(v Vehicle, automation *Automation, opts *AutomationOptions) (*AutomationEngine, error) {
+	if err := automation.check(); err != nil {
+		return nil, err
+	}
+	e := &AutomationEngine{
+		vehicle: v,
+		rules:   automation.Rules,
+		holding: map[string]bool{},
+	}
+	if opts != nil {
+		e.opts = *opts
+	}
+	monitor, err := NewGeofenceMonitor(automation.Geofences, e.opts.Geofences)
+	if err != nil {
+		return nil, err
+	}
+	e.monitor = monitor
+	return e, nil
+}
+
+// Evaluate updates the engine with the snapshot taken at the given time, which
+// may be nil, and runs the actions of the rules that fire. Scheduled rules fire
+// if their schedule fired since the previous evaluation, so evaluations may be
+// further apart than a minute without missing them.
+func (e *AutomationEngine) Evaluate(ctx context.Context, snapshot *StateSnapshot, now time.Time) []*AutomationResult {
+	if snapshot == nil {
+		snapshot = &StateSnapshot{}
+	}
+	e.state.merge(snapshot)
+	if snapshot.DriveState != nil {
+		e.monitor.UpdateDriveState(snapshot.DriveState)
+	}
+
+	var results []*AutomationResult
+	for _, rule := range e.rules {
+		holds := e.holds(rule)
+		var fire bool
+		if rule.schedule != nil {
+			fire = holds && e.due(rule, now)
+		} else {
+			fire = holds && !e.holding[rule.Name]
+			e.holding[rule.Name] = holds
+		}
+		if fire {
+			results = append(results, e.run(ctx, rule, now)...)
+		}
+	}
+	e.lastEval = now
+	return results
+}
+
+// UpdateStreamEvent updates the vehicle's geofences from a stream event's location
+func (e *AutomationEngine) UpdateStreamEvent(event *StreamEvent) {
+	e.monitor.UpdateStreamEvent(event)
+}
+
+// holds reports whether every condition and geofence of the rule holds
+func (e *AutomationEngine) holds(rule *AutomationRule) bool {
+	for _, condition := range rule.Conditions {
+		value, ok := e.state.field(condition.Field)
+		if !ok || !compareValues(value, condition.Op, condition.Value) {
+			return false
+		}
+	}
+	for _, name := range rule.Inside {
+		if !e.monitor.Inside(name) {
+			return false
+		}
+	}
+	for _, name := range rule.Outside {
+		if e.monitor.Inside(name) {
+			return false
+		}
+	}
+	return true
+}
+
+// due reports whether the rule's schedule fired since the previous evaluation,
+// or in the current minute on the first evaluation
+func (e *AutomationEngine) due(rule *AutomationRule, now time.Time) bool {
+	now = now.In(rule.location)
+	if e.lastEval.IsZero() {
+		return rule.schedule.Matches(now)
+	}
+	next := rule.schedule.Next(e.lastEval.In(rule.location))
+	return !next.IsZero() && !next.After(now)
+}
+
+// run runs the rule's actions in order, or records them in dry run mode
+func (e *AutomationEngine) run(ctx context.Context, rule *AutomationRule, now time.Time) []*AutomationResult {
+	results := make([]*AutomationResult, 0, len(rule.Actions))
+	for _, action := range rule.Actions {
+		result := &AutomationResult{Rule: rule.Name, Action: action, Time: now, DryRun: e.opts.DryRun}
+		results = append(results, result)
+		if e.opts.DryRun {
+			continue
+		}
+		if action.Notify != "" {
+			if e.opts.Notify != nil {
+				e.opts.Notify(rule.Name, action.Notify)
+			}
+			continue
+		}
+		result.Response, result.Err = e.vehicle.Execute(ctx, action.Command, action.Args)
+	}
+	return results
+}
+
+// compareValues applies the operator to a state value and a rule's value,
+// comparing numerically when both are numbers
+func compareValues(actual interface{}, op string, expected interface{}) bool {
+	a, aok := toFloat(actual)
+	b, bok := toFloat(expected)
+	if aok && bok {
+		switch op {
+		case "==":
+			return a == b
+		case "!=":
+			return a != b
+		case "<":
+			return a < b
+		case "<=":
+			return a <= b
+		case ">":
+			return a > b
+		case ">=":
+			return a >= b
+		}
+		return false
+	}
+	switch op {
+	case "==":
+		return fmt.Sprint(actual) == fmt.Sprint(expected)
+	case "!=":
+		return fmt.Sprint(actual) != fmt.Sprint(expected)
+	}
+	return false
+}
+
+// toFloat converts the numeric values found in states and decoded documents to
+// a float64. It reports false for anything else, such as nulls the API returns
+// in place of numbers.
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,120 @@
+package tesla
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const automationYAML = `
+geofences:
+  - name: home
+    center: {latitude: 30, longitude: -100}
+    radius_meters: 100
+rules:
+  - name: plug in reminder
+    inside: [home]
+    conditions:
+      - {field: charge_state.battery_level, op: "<", value: 50}
+      - {field: charge_state.charging_state, op: "==", value: Disconnected}
+    actions:
+      - notify: Plug in the car
+  - name: precondition
+    schedule: "40 7 * * mon-fri"
+    time_zone: UTC
+    actions:
+      - command: set_temps
+        args: {driver_temp: 20.1, passenger_temp: 23.4}
+      - command: auto_conditioning_start
+`
+
+func TestAutomation(t *testing.T) {
+	ts := serveHTTP(t)
+	defer ts.Close()
+	previousURL := BaseURL
+	BaseURL = ts.URL + "/api/1"
+	defer func() { BaseURL = previousURL }()
+
+	auth := &Auth{
+		GrantType:    "password",
+		ClientID:     "someclient123",
+		ClientSecret: "somesecret456",
+		Email:        "nobody@example.com",
+		Password:     "pass",
+	}
+	NewClient(auth)
+	vehicle := Vehicle{ID: 123}
+
+	path := filepath.Join(os.TempDir(), "tesla-automation.yaml")
+	ioutil.WriteFile(path, []byte(automationYAML), 0600)
+	defer os.Remove(path)
+	automation, err := LoadAutomation(path)
+	assert.Nil(t, err)
+	assert.Len(t, automation.Rules, 2)
+
+	var messages []string
+	engine, err := NewAutomationEngine(vehicle, automation, &AutomationOptions{
+		Notify: func(rule string, message string) { messages = append(messages, rule+": "+message) },
+	})
+	assert.Nil(t, err)
+	ctx := context.Background()
+	// Monday 18 April 2016
+	monday := time.Date(2016, 4, 18, 7, 0, 0, 0, time.UTC)
+	home := &DriveState{Latitude: 30, Longitude: -100}
+	away := &DriveState{Latitude: 30.01, Longitude: -100}
+
+	assert.Empty(t, engine.Evaluate(ctx, &StateSnapshot{
+		ChargeState: &ChargeState{BatteryLevel: 40, ChargingState: "Disconnected"},
+		DriveState:  away,
+	}, monday))
+	results := engine.Evaluate(ctx, &StateSnapshot{DriveState: home}, monday.Add(10*time.Minute))
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, "plug in reminder", results[0].Rule)
+		assert.Nil(t, results[0].Err)
+	}
+	assert.Equal(t, []string{"plug in reminder: Plug in the car"}, messages)
+	// the reminder is sent once until its conditions stop holding
+	assert.Empty(t, engine.Evaluate(ctx, &StateSnapshot{DriveState: home}, monday.Add(20*time.Minute)))
+
+	// the schedule fired between evaluations
+	results = engine.Evaluate(ctx, &StateSnapshot{}, monday.Add(45*time.Minute))
+	if assert.Len(t, results, 2) {
+		assert.Equal(t, "set_temps", results[0].Action.Command)
+		assert.Nil(t, results[0].Err)
+		assert.True(t, results[0].Response.Response.Result)
+		assert.Nil(t, results[1].Err)
+	}
+	// nil snapshots, when no state was read, leave the engine's state as it was
+	assert.Empty(t, engine.Evaluate(ctx, nil, monday.Add(50*time.Minute)))
+
+	engine.Evaluate(ctx, &StateSnapshot{ChargeState: &ChargeState{BatteryLevel: 40, ChargingState: "Charging"}}, monday.Add(60*time.Minute))
+	dryRun, _ := NewAutomationEngine(vehicle, automation, &AutomationOptions{DryRun: true})
+	results = dryRun.Evaluate(ctx, &StateSnapshot{
+		ChargeState: &ChargeState{BatteryLevel: 40, ChargingState: "Disconnected"},
+		DriveState:  home,
+	}, monday.Add(40*time.Minute))
+	assert.Len(t, results, 3)
+	for _, result := range results {
+		assert.True(t, result.DryRun)
+		assert.Nil(t, result.Response)
+	}
+	assert.Len(t, messages, 1)
+
+	for _, invalid := range []string{
+		`{"rules": [{"name": "a", "actions": []}]}`,
+		`{"rules": [{"name": "a", "schedule": "daily", "actions": [{"notify": "hi"}]}]}`,
+		`{"rules": [{"name": "a", "conditions": [{"field": "charge_state.nothing", "op": "=="}], "actions": [{"notify": "hi"}]}]}`,
+		`{"rules": [{"name": "a", "conditions": [{"field": "charge_state.battery_level", "op": "~"}], "actions": [{"notify": "hi"}]}]}`,
+		`{"rules": [{"name": "a", "inside": ["work"], "actions": [{"notify": "hi"}]}]}`,
+		`{"rules": [{"name": "a", "actions": [{"command": "self_destruct"}]}]}`,
+		`{"rules": [{"name": "a", "actions": [{"command": "set_temps", "args": {"fahrenheit": true}}]}]}`,
+	} {
+		_, err = ParseAutomation([]byte(invalid))
+		assert.NotNil(t, err, invalid)
+	}
+}
@@ -0,0 +1,230 @@
+package tesla
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// BatterySample is a reading of the battery's level and range. Ranges are in
+// miles, as in ChargeState.
+type BatterySample struct {
+	Time               time.Time `json:"time"`
+	BatteryLevel       int       `json:"battery_level"`
+	UsableBatteryLevel int       `json:"usable_battery_level"`
+	BatteryRange       float64   `json:"battery_range"`
+	IdealBatteryRange  float64   `json:"ideal_battery_range"`
+}
+
+// BatteryEstimate is the range and capacity of the full battery estimated from
+// the samples of a period
+type BatteryEstimate struct {
+	// Time is the middle of the samples the estimate comes from
+	Time time.Time `json:"time"`
+	// FullRange and FullIdealRange are the rated and ideal range at 100% in miles
+	FullRange      float64 `json:"full_range"`
+	FullIdealRange float64 `json:"full_ideal_range"`
+	// Capacity is the usable energy of the full battery in kWh, if RatedWhPerMile is set
+	Capacity float64 `json:"capacity,omitempty"`
+	Samples  int     `json:"samples"`
+}
+
+// ColdBatteryGap is a period during which part of the battery's charge was
+// unusable because the battery was cold
+type ColdBatteryGap struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// MaxGap is the largest difference between BatteryLevel and UsableBatteryLevel
+	MaxGap int `json:"max_gap"`
+}
+
+// BatteryTrend is a straight line fitted to the estimated full range over time
+type BatteryTrend struct {
+	Start      time.Time `json:"start"`
+	StartRange float64   `json:"start_range"`
+	// RangePerYear is negative as the battery degrades
+	RangePerYear float64 `json:"range_per_year"`
+	// PercentPerYear is RangePerYear as a percentage of StartRange
+	PercentPerYear float64 `json:"percent_per_year"`
+}
+
+// BatteryHealth is the result of analyzing battery samples
+type BatteryHealth struct {
+	Estimates []BatteryEstimate `json:"estimates"`
+	ColdGaps  []ColdBatteryGap  `json:"cold_gaps,omitempty"`
+	Trend     BatteryTrend      `json:"trend"`
+	// Degradation is the fraction of the original full range lost by the latest estimate
+	Degradation float64 `json:"degradation"`
+}
+
+// BatteryHealthOptions configures the analysis of battery samples. Options that
+// are not set use their defaults.
+type BatteryHealthOptions struct {
+	// Period is the span of samples each estimate is made from; defaults to 30 days
+	Period time.Duration
+	// MinLevel is the lowest usable battery level of samples used for estimates,
+	// as the range of nearly empty batteries rounds poorly; defaults to 50
+	MinLevel int
+	// ColdGap is the smallest difference between the battery level and the
+	// usable battery level that counts as a cold battery; defaults to 2
+	ColdGap int
+	// RatedWhPerMile is the energy the vehicle counts per mile of rated range,
+	// which depends on the model, used to estimate capacity
+	RatedWhPerMile float64
+	// OriginalRange is the full rated range when new; defaults to the first estimate
+	OriginalRange float64
+}
+
+var (
+	defaultBatteryPeriod  = 30 * 24 * time.Hour
+	defaultBatteryMinimum = 50
+	defaultColdGap        = 2
+)
+
+// NewBatterySample reads a battery sample from the charge state read at the given time
+func NewBatterySample(t time.Time, charge *ChargeState) BatterySample {
+	return BatterySample{
+		Time:               t,
+		BatteryLevel:       charge.BatteryLevel,
+		UsableBatteryLevel: charge.UsableBatteryLevel,
+		BatteryRange:       charge.BatteryRange,
+		IdealBatteryRange:  charge.IdealBatteryRange,
+	}
+}
+
+// Predict returns the full rated range the trend expects at the given time
+func (t BatteryTrend) Predict(at time.Time) float64 {
+	return t.StartRange + t.RangePerYear*years(at.Sub(t.Start))
+}
+
+// AnalyzeBatteryHealth estimates the battery's full range and capacity over time
+// from samples in any order. Range only counts usable charge, so estimates
+// divide it by the usable battery level and are unaffected by a cold battery.
+func AnalyzeBatteryHealth(samples []BatterySample, opts *BatteryHealthOptions) (*BatteryHealth, error) {
+	o := BatteryHealthOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.Period <= 0 {
+		o.Period = defaultBatteryPeriod
+	}
+	if o.MinLevel <= 0 {
+		o.MinLevel = defaultBatteryMinimum
+	}
+	if o.ColdGap <= 0 {
+		o.ColdGap = defaultColdGap
+	}
+
+	sorted := append([]BatterySample{}, samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Time.Before(sorted[j].Time) })
+	health := &BatteryHealth{ColdGaps: coldBatteryGaps(sorted, o.ColdGap)}
+
+	var usable []BatterySample
+	for _, sample := range sorted {
+		if sample.UsableBatteryLevel >= o.MinLevel && sample.BatteryRange > 0 {
+			usable = append(usable, sample)
+		}
+	}
+	if len(usable) == 0 {
+		return nil, errors.New("no battery samples above the minimum level")
+	}
+
+	for start := 0; start < len(usable); {
+		end := start
+		for end < len(usable) && usable[end].Time.Sub(usable[start].Time) < o.Period {
+			end++
+		}
+		health.Estimates = append(health.Estimates, estimateBattery(usable[start:end], o.RatedWhPerMile))
+		start = end
+	}
+
+	// least squares fit of each sample's full range against years since the first sample
+	first := usable[0].Time
+	var n, sumX, sumY, sumXY, sumXX float64
+	for _, sample := range usable {
+		x := years(sample.Time.Sub(first))
+		y := fullRange(sample.BatteryRange, sample)
+		n++
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	health.Trend.Start = first
+	health.Trend.StartRange = sumY / n
+	if denominator := n*sumXX - sumX*sumX; denominator > 0 {
+		health.Trend.RangePerYear = (n*sumXY - sumX*sumY) / denominator
+		health.Trend.StartRange = (sumY - health.Trend.RangePerYear*sumX) / n
+		health.Trend.PercentPerYear = health.Trend.RangePerYear / health.Trend.StartRange * 100
+	}
+
+	original := o.OriginalRange
+	if original <= 0 {
+		original = health.Estimates[0].FullRange
+	}
+	latest := health.Estimates[len(health.Estimates)-1].FullRange
+	health.Degradation = 1 - latest/original
+	return health, nil
+}
+
+// estimateBattery returns the median full range of the samples
+func estimateBattery(samples []BatterySample, whPerMile float64) BatteryEstimate {
+	ranges := make([]float64, len(samples))
+	ideal := make([]float64, len(samples))
+	for i, sample := range samples {
+		ranges[i] = fullRange(sample.BatteryRange, sample)
+		ideal[i] = fullRange(sample.IdealBatteryRange, sample)
+	}
+	span := samples[len(samples)-1].Time.Sub(samples[0].Time)
+	estimate := BatteryEstimate{
+		Time:           samples[0].Time.Add(span / 2),
+		FullRange:      median(ranges),
+		FullIdealRange: median(ideal),
+		Samples:        len(samples),
+	}
+	estimate.Capacity = estimate.FullRange * whPerMile / 1000
+	return estimate
+}
+
+// coldBatteryGaps returns the periods of consecutive samples in which the
+// usable battery level trails the battery level by at least minGap
+func coldBatteryGaps(samples []BatterySample, minGap int) []ColdBatteryGap {
+	var gaps []ColdBatteryGap
+	var current *ColdBatteryGap
+	for _, sample := range samples {
+		gap := sample.BatteryLevel - sample.UsableBatteryLevel
+		if gap < minGap {
+			current = nil
+			continue
+		}
+		if current == nil {
+			gaps = append(gaps, ColdBatteryGap{Start: sample.Time})
+			current = &gaps[len(gaps)-1]
+		}
+		current.End = sample.Time
+		if gap > current.MaxGap {
+			current.MaxGap = gap
+		}
+	}
+	return gaps
+}
+
+// fullRange scales a range read with the sample to a full battery
+func fullRange(r float64, sample BatterySample) float64 {
+	return r / float64(sample.UsableBatteryLevel) * 100
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
+
+// years converts a duration to years of 365.25 days
+func years(d time.Duration) float64 {
+	return d.Hours() / 24 / 365.25
+}
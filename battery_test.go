@@ -0,0 +1,67 @@
+package tesla
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyzeBatteryHealth(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	month := time.Duration(365.25 / 12 * 24 * float64(time.Hour))
+	day := 24 * time.Hour
+	// the full range falls by 5 miles a year from 310
+	full := func(at time.Time) float64 { return 310 - 5*years(at.Sub(start)) }
+	sample := func(at time.Time, level, usable int) BatterySample {
+		r := full(at) * float64(usable) / 100
+		return BatterySample{Time: at, BatteryLevel: level, UsableBatteryLevel: usable, BatteryRange: r, IdealBatteryRange: r * 1.25}
+	}
+
+	var samples []BatterySample
+	for i := 23; i >= 0; i-- {
+		at := start.Add(time.Duration(i) * month)
+		samples = append(samples, sample(at, 80, 80))
+		if i < 2 {
+			// a cold battery, which still estimates the full range
+			samples = append(samples, sample(at.Add(day), 60, 57), sample(at.Add(2*day), 60, 58))
+		}
+		// too low to estimate from
+		samples = append(samples, BatterySample{Time: at.Add(3 * day), BatteryLevel: 20, UsableBatteryLevel: 20, BatteryRange: 1})
+	}
+
+	health, err := AnalyzeBatteryHealth(samples, &BatteryHealthOptions{RatedWhPerMile: 250})
+	assert.Nil(t, err)
+	if !assert.Len(t, health.Estimates, 24) {
+		return
+	}
+	first := health.Estimates[0]
+	assert.Equal(t, 3, first.Samples)
+	assert.Equal(t, start.Add(day), first.Time)
+	assert.InDelta(t, full(start.Add(day)), first.FullRange, 1e-9)
+	assert.InDelta(t, full(start.Add(day))*1.25, first.FullIdealRange, 1e-9)
+	assert.InDelta(t, 77.5, first.Capacity, 0.01)
+
+	assert.Equal(t, []ColdBatteryGap{
+		{Start: start.Add(day), End: start.Add(2 * day), MaxGap: 3},
+		{Start: start.Add(month + day), End: start.Add(month + 2*day), MaxGap: 3},
+	}, health.ColdGaps)
+
+	assert.Equal(t, start, health.Trend.Start)
+	assert.InDelta(t, 310, health.Trend.StartRange, 1e-6)
+	assert.InDelta(t, -5, health.Trend.RangePerYear, 1e-6)
+	assert.InDelta(t, -5.0/310*100, health.Trend.PercentPerYear, 1e-6)
+	assert.InDelta(t, 300, health.Trend.Predict(start.Add(2*365*day+12*time.Hour)), 1e-6)
+	assert.InDelta(t, 1-full(start.Add(23*month))/full(start.Add(day)), health.Degradation, 1e-9)
+
+	health, err = AnalyzeBatteryHealth(samples, &BatteryHealthOptions{OriginalRange: 320})
+	assert.Nil(t, err)
+	assert.InDelta(t, 1-full(start.Add(23*month))/320, health.Degradation, 1e-9)
+	assert.Zero(t, health.Estimates[0].Capacity)
+
+	_, err = AnalyzeBatteryHealth(samples[len(samples)-1:], nil)
+	assert.NotNil(t, err)
+
+	charge := &ChargeState{BatteryLevel: 90, UsableBatteryLevel: 89, BatteryRange: 235.92, IdealBatteryRange: 304.73}
+	assert.Equal(t, BatterySample{Time: start, BatteryLevel: 90, UsableBatteryLevel: 89, BatteryRange: 235.92, IdealBatteryRange: 304.73}, NewBatterySample(start, charge))
+}
@@ -0,0 +1,328 @@
+package tesla
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// SolarSource reports the power available from solar generation
+type SolarSource interface {
+	// Surplus returns the power in kW generated beyond what the household uses,
+	// not counting what the vehicle draws while charging
+	Surplus(ctx context.Context) (float64, error)
+}
+
+// ChargeControllerOptions configures a charge controller. Set Solar to follow
+// the solar surplus, or Tariff and Departure to charge in the cheapest window
+// before departure. Options that are not set use their defaults.
+type ChargeControllerOptions struct {
+	Solar  SolarSource
+	Tariff *Tariff
+	// Departure is the "15:04" clock time the vehicle must be charged by each
+	// day, in the tariff's time zone or the local time zone without a tariff.
+	// When following the solar surplus, the vehicle charges at full current
+	// once it would otherwise miss the departure.
+	Departure string
+	// TargetSoc is the battery level to charge to; defaults to the vehicle's charge limit
+	TargetSoc int
+	// MinSoc is the battery level below which the vehicle charges at full
+	// current regardless of the tariff or surplus; defaults to 20
+	MinSoc int
+	// Capacity is the usable energy of the full battery in kWh, used to estimate
+	// charging times; defaults to 75
+	Capacity float64
+	// Voltage and Phases convert between power and current while the charger
+	// does not report its voltage; default to 240 and 1
+	Voltage float64
+	Phases  int
+	// MinAmps is the lowest current worth charging at from the solar surplus; defaults to 5
+	MinAmps int
+	// AmpsDeadband is the smallest change of current sent to the vehicle; defaults to 2
+	AmpsDeadband int
+	// MinToggleInterval is how long the charger stays started or stopped before
+	// it is toggled again, unless the battery is below MinSoc; defaults to 15 minutes
+	MinToggleInterval time.Duration
+	// Interval is the delay between steps once the controller is started; defaults to 5 minutes
+	Interval time.Duration
+}
+
+// ChargeDecision is the outcome of a step of the charge controller
+type ChargeDecision struct {
+	Time time.Time
+	// Charge and Amps are what the controller wants the charger to do
+	Charge bool
+	Amps   int
+	// Reason is one of "disconnected", "minimum soc", "target reached",
+	// "departure", "cheapest window", "waiting for cheaper window", "solar
+	// surplus" and "insufficient surplus"
+	Reason string
+	// WindowStart is the start of the cheapest window when following a tariff
+	WindowStart time.Time
+	// Held is set when the charger was not toggled because it was toggled less
+	// than MinToggleInterval ago
+	Held bool
+	// Commands are the names of the commands sent to the vehicle
+	Commands []string
+}
+
+// ChargeController starts and stops charging, and adjusts the charging current,
+// to follow a tariff or the solar surplus
+type ChargeController struct {
+	// Errors is buffered and dropped if not read. It is closed once a started controller is closed.
+	Errors chan error
+
+	vehicle    Vehicle
+	opts       ChargeControllerOptions
+	location   *time.Location
+	lastToggle time.Time
+
+	runMu     sync.Mutex
+	done      chan struct{}
+	stopped   chan struct{}
+	startOnce sync.Once
+	closeOnce sync.Once
+}
+
+var (
+	defaultMinSoc            = 20
+	defaultCapacity          = 75.0
+	defaultVoltage           = 240.0
+	defaultMinAmps           = 5
+	defaultAmpsDeadband      = 2
+	defaultMinToggleInterval = 15 * time.Minute
+	defaultControlInterval   = 5 * time.Minute
+)
+
+// NewChargeController creates a controller for the vehicle's charging
+func NewChargeController(v Vehicle, opts *ChargeControllerOptions) (*ChargeController, error) {
+	c := &ChargeController{
+		Errors:  make(chan error, 16),
+		vehicle: v,
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	if opts != nil {
+		c.opts = *opts
+	}
+	if c.opts.Solar == nil && c.opts.Tariff == nil {
+		return nil, errors.New("charge controller needs a tariff or a solar source")
+	}
+	if c.opts.Solar == nil && c.opts.Departure == "" {
+		return nil, errors.New("charge controller needs a departure time to follow a tariff")
+	}
+	if c.opts.Departure != "" {
+		if _, err := parseClock(c.opts.Departure); err != nil {
+			return nil, err
+		}
+	}
+	c.location = time.Local
+	if c.opts.Tariff != nil {
+		if err := c.opts.Tariff.check(); err != nil {
+			return nil, err
+		}
+		location, err := c.opts.Tariff.zone()
+		if err != nil {
+			return nil, err
+		}
+		c.location = location
+	}
+	if c.opts.MinSoc <= 0 {
+		c.opts.MinSoc = defaultMinSoc
+	}
+	if c.opts.Capacity <= 0 {
+		c.opts.Capacity = defaultCapacity
+	}
+	if c.opts.Voltage <= 0 {
+		c.opts.Voltage = defaultVoltage
+	}
+	if c.opts.Phases <= 0 {
+		c.opts.Phases = 1
+	}
+	if c.opts.MinAmps <= 0 {
+		c.opts.MinAmps = defaultMinAmps
+	}
+	if c.opts.AmpsDeadband <= 0 {
+		c.opts.AmpsDeadband = defaultAmpsDeadband
+	}
+	if c.opts.MinToggleInterval <= 0 {
+		c.opts.MinToggleInterval = defaultMinToggleInterval
+	}
+	if c.opts.Interval <= 0 {
+		c.opts.Interval = defaultControlInterval
+	}
+	return c, nil
+}
+
+// Start steps the controller every interval until it is closed
+func (c *ChargeController) Start() {
+	c.startOnce.Do(func() {
+		go func() {
+			defer func() {
+				close(c.Errors)
+				close(c.stopped)
+			}()
+			for {
+				if _, err := c.Step(context.Background(), time.Now()); err != nil {
+					select {
+					case c.Errors <- err:
+					default:
+					}
+				}
+				select {
+				case <-c.done:
+					return
+				case <-time.After(c.opts.Interval):
+				}
+			}
+		}()
+	})
+}
+
+// Close stops the controller, waiting for any step in progress, if it was started
+func (c *ChargeController) Close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+	started := true
+	c.startOnce.Do(func() { started = false })
+	if started {
+		<-c.stopped
+	}
+}
+
+// Step reads the vehicle's charge state, decides whether it should charge and
+// at what current, and sends the commands needed to get there
+func (c *ChargeController) Step(ctx context.Context, now time.Time) (*ChargeDecision, error) {
+	c.runMu.Lock()
+	defer c.runMu.Unlock()
+	charge, err := c.vehicle.ChargeState()
+	if err != nil {
+		return nil, err
+	}
+	decision, force, err := c.decide(ctx, charge, now)
+	if err != nil {
+		return nil, err
+	}
+	if decision.Reason == "disconnected" {
+		return decision, nil
+	}
+
+	charging := charge.ChargingState == "Charging"
+	if decision.Charge {
+		// small changes are ignored so the current follows the surplus without
+		// a command each step, except to return to full current
+		diff := math.Abs(float64(decision.Amps - charge.ChargeCurrentRequest))
+		if diff > 0 && (diff >= float64(c.opts.AmpsDeadband) || decision.Amps == charge.ChargeCurrentRequestMax) {
+			if err = c.vehicle.SetChargingAmps(decision.Amps); err != nil {
+				return decision, err
+			}
+			decision.Commands = append(decision.Commands, "set_charging_amps")
+		}
+	}
+	if decision.Charge == charging {
+		return decision, nil
+	}
+	if !force && !c.lastToggle.IsZero() && now.Sub(c.lastToggle) < c.opts.MinToggleInterval {
+		decision.Held = true
+		return decision, nil
+	}
+	if decision.Charge {
+		err = c.vehicle.StartCharging()
+		decision.Commands = append(decision.Commands, "charge_start")
+	} else {
+		err = c.vehicle.StopCharging()
+		decision.Commands = append(decision.Commands, "charge_stop")
+	}
+	if err != nil {
+		return decision, err
+	}
+	c.lastToggle = now
+	return decision, nil
+}
+
+// decide returns what the charger should do given the charge state, and
+// whether the minimum toggle interval may be ignored to do it
+func (c *ChargeController) decide(ctx context.Context, charge *ChargeState, now time.Time) (*ChargeDecision, bool, error) {
+	decision := &ChargeDecision{Time: now, Amps: charge.ChargeCurrentRequestMax}
+	target := c.opts.TargetSoc
+	if target <= 0 || target > charge.ChargeLimitSoc {
+		target = charge.ChargeLimitSoc
+	}
+	switch {
+	case charge.ChargingState == "Disconnected":
+		decision.Reason = "disconnected"
+		return decision, false, nil
+	case charge.BatteryLevel < c.opts.MinSoc:
+		decision.Charge = true
+		decision.Reason = "minimum soc"
+		return decision, true, nil
+	case charge.BatteryLevel >= target:
+		decision.Reason = "target reached"
+		return decision, false, nil
+	case charge.ChargeCurrentRequestMax <= 0:
+		return nil, false, errors.New("vehicle reports no maximum charging current")
+	}
+
+	// how long charging to the target takes at full current, to the minute
+	volts := c.opts.Voltage
+	if v, ok := toFloat(charge.ChargerVoltage); ok && v > 100 {
+		volts = v
+	}
+	perAmp := volts * float64(c.opts.Phases) / 1000
+	needed := float64(target-charge.BatteryLevel) / 100 * c.opts.Capacity
+	duration := time.Duration(math.Ceil(needed/(perAmp*float64(charge.ChargeCurrentRequestMax))*60)) * time.Minute
+
+	var departure time.Time
+	if c.opts.Departure != "" {
+		departure = c.departure(now)
+		if departure.Sub(now) <= duration {
+			decision.Charge = true
+			decision.Reason = "departure"
+			return decision, false, nil
+		}
+	}
+
+	if c.opts.Solar != nil {
+		surplus, err := c.opts.Solar.Surplus(ctx)
+		if err != nil {
+			return nil, false, err
+		}
+		amps := int(surplus / perAmp)
+		if amps < c.opts.MinAmps {
+			decision.Reason = "insufficient surplus"
+			return decision, false, nil
+		}
+		if amps < decision.Amps {
+			decision.Amps = amps
+		}
+		decision.Charge = true
+		decision.Reason = "solar surplus"
+		return decision, false, nil
+	}
+
+	start, _, err := c.opts.Tariff.CheapestWindow(now, departure, duration)
+	if err != nil {
+		return nil, false, err
+	}
+	decision.WindowStart = start
+	decision.Charge = !now.Before(start) && now.Before(start.Add(duration))
+	decision.Reason = "waiting for cheaper window"
+	if decision.Charge {
+		decision.Reason = "cheapest window"
+	}
+	return decision, false, nil
+}
+
+// departure returns the next departure after now
+func (c *ChargeController) departure(now time.Time) time.Time {
+	minutes, _ := parseClock(c.opts.Departure)
+	local := now.In(c.location)
+	departure := time.Date(local.Year(), local.Month(), local.Day(), minutes/60, minutes%60, 0, 0, c.location)
+	if !departure.After(now) {
+		departure = time.Date(local.Year(), local.Month(), local.Day()+1, minutes/60, minutes%60, 0, 0, c.location)
+	}
+	return departure
+}
@@ -0,0 +1,144 @@
+package tesla
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fixedSurplus float64
+
+func (s *fixedSurplus) Surplus(ctx context.Context) (float64, error) {
+	return float64(*s), nil
+}
+
+func TestChargeController(t *testing.T) {
+	var mu sync.Mutex
+	charge := &ChargeState{ChargingState: "Stopped", BatteryLevel: 50, ChargeLimitSoc: 90, ChargeCurrentRequest: 40, ChargeCurrentRequestMax: 40}
+	var sent []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch req.URL.Path {
+		case "/oauth/token":
+			w.Write([]byte(`{"access_token": "sometoken123"}`))
+		case "/api/1/vehicles/123/data_request/charge_state":
+			json.NewEncoder(w).Encode(map[string]interface{}{"response": charge})
+		case "/api/1/vehicles/123/command/set_charging_amps":
+			request := &ChargingAmpsRequest{}
+			json.NewDecoder(req.Body).Decode(request)
+			charge.ChargeCurrentRequest = request.ChargingAmps
+			sent = append(sent, "set_charging_amps")
+			w.Write([]byte(CommandResponseJSON))
+		case "/api/1/vehicles/123/command/charge_start",
+			"/api/1/vehicles/123/command/charge_stop":
+			charge.ChargingState = map[bool]string{true: "Charging", false: "Stopped"}[strings.HasSuffix(req.URL.Path, "start")]
+			sent = append(sent, req.URL.Path[strings.LastIndex(req.URL.Path, "/")+1:])
+			w.Write([]byte(CommandResponseJSON))
+		}
+	}))
+	defer ts.Close()
+	previousURL := BaseURL
+	BaseURL = ts.URL + "/api/1"
+	defer func() { BaseURL = previousURL }()
+
+	auth := &Auth{
+		GrantType:    "password",
+		ClientID:     "someclient123",
+		ClientSecret: "somesecret456",
+		Email:        "nobody@example.com",
+		Password:     "pass",
+	}
+	NewClient(auth)
+	vehicle := Vehicle{ID: 123}
+	ctx := context.Background()
+
+	_, err := NewChargeController(vehicle, nil)
+	assert.NotNil(t, err)
+	_, err = NewChargeController(vehicle, &ChargeControllerOptions{Tariff: &Tariff{Flat: 0.1}})
+	assert.NotNil(t, err)
+
+	// 2.4 kW at 240 V is 10 A
+	surplus := fixedSurplus(2.4)
+	c, err := NewChargeController(vehicle, &ChargeControllerOptions{Solar: &surplus})
+	assert.Nil(t, err)
+	now := time.Date(2020, 7, 1, 12, 0, 0, 0, time.UTC)
+	decision, err := c.Step(ctx, now)
+	assert.Nil(t, err)
+	assert.Equal(t, &ChargeDecision{Time: now, Charge: true, Amps: 10, Reason: "solar surplus", Commands: []string{"set_charging_amps", "charge_start"}}, decision)
+
+	// changes within the deadband are not sent
+	surplus = 2.64
+	decision, err = c.Step(ctx, now.Add(5*time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, 11, decision.Amps)
+	assert.Empty(t, decision.Commands)
+
+	// the charger is only stopped once it has been charging for a while
+	surplus = 0.5
+	decision, err = c.Step(ctx, now.Add(10*time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, "insufficient surplus", decision.Reason)
+	assert.True(t, decision.Held)
+	decision, err = c.Step(ctx, now.Add(20*time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"charge_stop"}, decision.Commands)
+
+	// low batteries charge at full current straight away
+	mu.Lock()
+	charge.BatteryLevel = 15
+	mu.Unlock()
+	decision, err = c.Step(ctx, now.Add(21*time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, "minimum soc", decision.Reason)
+	assert.Equal(t, []string{"set_charging_amps", "charge_start"}, decision.Commands)
+
+	mu.Lock()
+	assert.Equal(t, 40, charge.ChargeCurrentRequest)
+	charge.ChargingState = "Disconnected"
+	mu.Unlock()
+	decision, err = c.Step(ctx, now.Add(30*time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, "disconnected", decision.Reason)
+	assert.Empty(t, decision.Commands)
+	mu.Lock()
+	assert.Equal(t, []string{"set_charging_amps", "charge_start", "charge_stop", "set_charging_amps", "charge_start"}, sent)
+	mu.Unlock()
+
+	// 7.5 kWh at 9.6 kW takes 47 minutes, cheapest from midnight
+	tariff, err := LoadTariff(writeTemp(t, TariffJSON))
+	assert.Nil(t, err)
+	c, err = NewChargeController(vehicle, &ChargeControllerOptions{Tariff: tariff, Departure: "07:00"})
+	assert.Nil(t, err)
+	mu.Lock()
+	charge.ChargingState = "Stopped"
+	charge.BatteryLevel = 80
+	mu.Unlock()
+	evening := time.Date(2020, 7, 1, 20, 0, 0, 0, time.UTC)
+	decision, err = c.Step(ctx, evening)
+	assert.Nil(t, err)
+	assert.False(t, decision.Charge)
+	assert.Equal(t, "waiting for cheaper window", decision.Reason)
+	assert.Equal(t, time.Date(2020, 7, 2, 0, 0, 0, 0, time.UTC), decision.WindowStart)
+	decision, err = c.Step(ctx, evening.Add(4*time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, "cheapest window", decision.Reason)
+	assert.Equal(t, []string{"charge_start"}, decision.Commands)
+
+	// charging to the target would miss the departure
+	mu.Lock()
+	charge.ChargingState = "Stopped"
+	charge.BatteryLevel = 30
+	mu.Unlock()
+	decision, err = c.Step(ctx, evening.Add(10*time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, "departure", decision.Reason)
+	assert.Equal(t, []string{"charge_start"}, decision.Commands)
+}
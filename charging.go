@@ -0,0 +1,209 @@
+package tesla
+
+import (
+	"sort"
+	"time"
+)
+
+// ChargeSample is a reading of the charger taken during a charging session.
+// Power is in kW, Voltage in volts and Current in amps; EnergyAdded is the
+// vehicle's count of kWh added, as in ChargeState.ChargeEnergyAdded.
+type ChargeSample struct {
+	Time         time.Time `json:"time"`
+	Power        float64   `json:"power"`
+	Voltage      float64   `json:"voltage"`
+	Current      float64   `json:"current"`
+	BatteryLevel int       `json:"battery_level"`
+	EnergyAdded  float64   `json:"energy_added"`
+	// Resumed is set on the first sample after the charge was stopped, as the
+	// time since the previous sample was not all spent charging
+	Resumed bool `json:"resumed,omitempty"`
+}
+
+// ChargeCurvePoint is the highest power drawn at a battery level
+type ChargeCurvePoint struct {
+	BatteryLevel int     `json:"battery_level"`
+	Power        float64 `json:"power"`
+}
+
+// ChargingSession is a charge from when the vehicle starts charging until the
+// charge completes or the charger is disconnected. Energy is in kWh and power in
+// kW; AveragePower is averaged over the time spent charging, leaving out stops.
+type ChargingSession struct {
+	Start           time.Time      `json:"start"`
+	End             time.Time      `json:"end"`
+	Location        *Location      `json:"location"`
+	FastCharger     bool           `json:"fast_charger"`
+	FastChargerType string         `json:"fast_charger_type,omitempty"`
+	StartSoc        int            `json:"start_soc"`
+	EndSoc          int            `json:"end_soc"`
+	EnergyAdded     float64        `json:"energy_added_kwh"`
+	PeakPower       float64        `json:"peak_power"`
+	AveragePower    float64        `json:"average_power"`
+	EndState        string         `json:"end_state"`
+	Samples         []ChargeSample `json:"samples"`
+}
+
+// Duration of the session
+func (s *ChargingSession) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// Curve returns the charging curve: the highest power drawn at each battery
+// level reached during the session, in order of battery level
+func (s *ChargingSession) Curve() []ChargeCurvePoint {
+	peaks := map[int]float64{}
+	for _, sample := range s.Samples {
+		if power, ok := peaks[sample.BatteryLevel]; !ok || sample.Power > power {
+			peaks[sample.BatteryLevel] = sample.Power
+		}
+	}
+	curve := make([]ChargeCurvePoint, 0, len(peaks))
+	for level, power := range peaks {
+		curve = append(curve, ChargeCurvePoint{BatteryLevel: level, Power: power})
+	}
+	sort.Slice(curve, func(i, j int) bool { return curve[i].BatteryLevel < curve[j].BatteryLevel })
+	return curve
+}
+
+// Cost of the energy added at a flat price per kWh
+func (s *ChargingSession) Cost(pricePerKWh float64) float64 {
+	return s.EnergyAdded * pricePerKWh
+}
+
+// integratedEnergy returns the kWh drawn according to the power samples and the
+// hours spent charging between them, leaving out stops
+func (s *ChargingSession) integratedEnergy() (float64, float64) {
+	var energy, charging float64
+	for i := 1; i < len(s.Samples); i++ {
+		if s.Samples[i].Resumed {
+			continue
+		}
+		hours := s.Samples[i].Time.Sub(s.Samples[i-1].Time).Hours()
+		energy += (s.Samples[i].Power + s.Samples[i-1].Power) / 2 * hours
+		charging += hours
+	}
+	return energy, charging
+}
+
+// ChargingRecorder groups charge states into charging sessions. A session opens
+// when the charging state becomes "Charging" and closes when it becomes
+// "Complete" or "Disconnected"; a stopped charge that resumes continues the
+// same session.
+type ChargingRecorder struct {
+	current *ChargingSession
+	stopped bool
+}
+
+// NewChargingRecorder creates a recorder with no session in progress
+func NewChargingRecorder() *ChargingRecorder {
+	return &ChargingRecorder{}
+}
+
+// DetectChargingSessions reads snapshots until the channel is closed and sends each charging session recorded
+func DetectChargingSessions(snapshots <-chan *WatchSnapshot) <-chan *ChargingSession {
+	sessions := make(chan *ChargingSession)
+	go func() {
+		defer close(sessions)
+		r := NewChargingRecorder()
+		for snapshot := range snapshots {
+			if snapshot.ChargeState == nil {
+				continue
+			}
+			if session := r.Add(snapshot.Time, snapshot.ChargeState, snapshot.DriveState); session != nil {
+				sessions <- session
+			}
+		}
+		if session := r.Flush(); session != nil {
+			sessions <- session
+		}
+	}()
+	return sessions
+}
+
+// Current returns the session in progress, if any
+func (r *ChargingRecorder) Current() *ChargingSession {
+	return r.current
+}
+
+// Add processes a charge state read at the given time, and the drive state read
+// with it, if any. It returns the session the charge state closes, if any.
+func (r *ChargingRecorder) Add(t time.Time, charge *ChargeState, drive *DriveState) *ChargingSession {
+	switch charge.ChargingState {
+	case "Charging":
+		if r.current == nil {
+			r.current = &ChargingSession{Start: t, StartSoc: charge.BatteryLevel}
+		}
+		r.sample(t, charge, drive)
+	case "Complete", "Disconnected":
+		if r.current == nil {
+			return nil
+		}
+		r.current.End = t
+		r.current.EndSoc = charge.BatteryLevel
+		r.current.EndState = charge.ChargingState
+		r.current.EnergyAdded = charge.ChargeEnergyAdded
+		return r.Flush()
+	default:
+		r.stopped = r.current != nil
+	}
+	return nil
+}
+
+// Flush ends the session in progress and returns it
+func (r *ChargingRecorder) Flush() *ChargingSession {
+	session := r.current
+	r.current = nil
+	r.stopped = false
+	if session == nil {
+		return nil
+	}
+	if session.End.IsZero() && len(session.Samples) > 0 {
+		last := session.Samples[len(session.Samples)-1]
+		session.End = last.Time
+		session.EndSoc = last.BatteryLevel
+	}
+
+	// the vehicle's count, taken when the session closed or from the last
+	// sample, is preferred; it counts from the start of the charge even if the
+	// recorder saw it later. The power samples are used if the count restarted.
+	integrated, charging := session.integratedEnergy()
+	count := session.EnergyAdded
+	if n := len(session.Samples); n > 0 {
+		if count == 0 {
+			count = session.Samples[n-1].EnergyAdded
+		}
+		if count > 0 && count >= session.Samples[0].EnergyAdded {
+			session.EnergyAdded = count
+		} else {
+			session.EnergyAdded = integrated
+		}
+	}
+	if charging > 0 {
+		session.AveragePower = integrated / charging
+	} else if n := len(session.Samples); n > 0 {
+		session.AveragePower = session.Samples[0].Power
+	}
+	return session
+}
+
+// sample records the charger's readings and the session's location
+func (r *ChargingRecorder) sample(t time.Time, charge *ChargeState, drive *DriveState) {
+	session := r.current
+	sample := ChargeSample{Time: t, BatteryLevel: charge.BatteryLevel, EnergyAdded: charge.ChargeEnergyAdded, Resumed: r.stopped}
+	r.stopped = false
+	sample.Power, _ = toFloat(charge.ChargerPower)
+	sample.Voltage, _ = toFloat(charge.ChargerVoltage)
+	sample.Current, _ = toFloat(charge.ChargerActualCurrent)
+	session.Samples = append(session.Samples, sample)
+	if sample.Power > session.PeakPower {
+		session.PeakPower = sample.Power
+	}
+	if charge.FastChargerPresent {
+		session.FastCharger = true
+		session.FastChargerType = charge.FastChargerType
+	}
+	if session.Location == nil && drive != nil {
+		session.Location = driveLocation(drive)
+	}
+}
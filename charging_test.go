@@ -0,0 +1,77 @@
+package tesla
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChargingRecorder(t *testing.T) {
+	start := time.Unix(1460905367, 0)
+	drive := &DriveState{Latitude: 30, Longitude: -100}
+	states := []*ChargeState{
+		{ChargingState: "Disconnected", BatteryLevel: 50},
+		{ChargingState: "Charging", BatteryLevel: 50, ChargerPower: 7.0, ChargerVoltage: 240.0, ChargerActualCurrent: 32.0, ChargeEnergyAdded: 0.1},
+		{ChargingState: "Charging", BatteryLevel: 55, ChargerPower: 11.0, ChargerVoltage: 240.0, ChargerActualCurrent: 48.0, ChargeEnergyAdded: 4.6},
+		// a stopped charge that resumes stays in the same session
+		{ChargingState: "Stopped", BatteryLevel: 60, ChargerPower: nil, ChargeEnergyAdded: 9.1},
+		{ChargingState: "Charging", BatteryLevel: 60, ChargerPower: 11.0, ChargeEnergyAdded: 9.1},
+		{ChargingState: "Charging", BatteryLevel: 60, ChargerPower: 9.0, ChargeEnergyAdded: 9.4},
+		{ChargingState: "Complete", BatteryLevel: 64, ChargeEnergyAdded: 12.0},
+		{ChargingState: "Complete", BatteryLevel: 64, ChargeEnergyAdded: 12.0},
+	}
+
+	r := NewChargingRecorder()
+	var sessions []*ChargingSession
+	for i, state := range states {
+		if session := r.Add(start.Add(time.Duration(i)*30*time.Minute), state, drive); session != nil {
+			sessions = append(sessions, session)
+		}
+		if i == 2 {
+			assert.NotNil(t, r.Current())
+		}
+	}
+	assert.Nil(t, r.Current())
+	if !assert.Len(t, sessions, 1) {
+		return
+	}
+	session := sessions[0]
+	assert.Equal(t, start.Add(30*time.Minute), session.Start)
+	assert.Equal(t, 150*time.Minute, session.Duration())
+	assert.Equal(t, &Location{Latitude: 30, Longitude: -100}, session.Location)
+	assert.Equal(t, 50, session.StartSoc)
+	assert.Equal(t, 64, session.EndSoc)
+	assert.Equal(t, "Complete", session.EndState)
+	assert.Equal(t, 12.0, session.EnergyAdded)
+	assert.Equal(t, 11.0, session.PeakPower)
+	assert.Len(t, session.Samples, 4)
+	assert.Equal(t, ChargeSample{Time: start.Add(30 * time.Minute), Power: 7, Voltage: 240, Current: 32, BatteryLevel: 50, EnergyAdded: 0.1}, session.Samples[0])
+	// 4.5 + 5 kWh drawn over the hour spent charging, leaving out the hour around the stop
+	assert.True(t, session.Samples[2].Resumed)
+	assert.InDelta(t, 9.5, session.AveragePower, 1e-9)
+	assert.Equal(t, []ChargeCurvePoint{{50, 7}, {55, 11}, {60, 11}}, session.Curve())
+	assert.InDelta(t, 1.8, session.Cost(0.15), 1e-9)
+
+	// a counter that restarted falls back to the power samples
+	r.Add(start, &ChargeState{ChargingState: "Charging", BatteryLevel: 20, ChargerPower: 100.0, ChargeEnergyAdded: 30, FastChargerPresent: true, FastChargerType: "Tesla"}, nil)
+	r.Add(start.Add(30*time.Minute), &ChargeState{ChargingState: "Charging", BatteryLevel: 60, ChargerPower: 60.0, ChargeEnergyAdded: 1}, nil)
+	session = r.Flush()
+	assert.Equal(t, 40.0, session.EnergyAdded)
+	assert.True(t, session.FastCharger)
+	assert.Equal(t, "Tesla", session.FastChargerType)
+	assert.Nil(t, session.Location)
+	assert.Equal(t, start.Add(30*time.Minute), session.End)
+	assert.Equal(t, 60, session.EndSoc)
+
+	snapshots := make(chan *WatchSnapshot, len(states))
+	for i, state := range states {
+		snapshots <- &WatchSnapshot{Time: start.Add(time.Duration(i) * 30 * time.Minute), ChargeState: state}
+	}
+	close(snapshots)
+	var detected []*ChargingSession
+	for session := range DetectChargingSessions(snapshots) {
+		detected = append(detected, session)
+	}
+	assert.Len(t, detected, 1)
+}
@@ -2,9 +2,11 @@ package tesla
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"io/ioutil"
+	"log"
 	"net/http"
 	"net/url"
 	"path"
@@ -36,6 +38,16 @@ type Client struct {
 	HTTP           *http.Client
 	Token          *Token
 	StreamEndpoint *url.URL
+	// DryRun logs commands instead of sending them; requests for state are still made
+	DryRun bool
+	// Logger receives dry run output and audit failures; the standard logger is used when nil
+	Logger *log.Logger
+	// Policy is evaluated before every command is sent; nil allows all commands
+	Policy *Policy
+	// Audit receives an entry for every command sent to a vehicle; nil disables auditing
+	Audit AuditSink
+	// Verify enables verification of commands by re-reading the vehicle's state; nil disables it
+	Verify *VerifyOptions
 }
 
 var (
@@ -119,7 +131,12 @@ func (c Client) get(url string) ([]byte, error) {
 
 // post makes an HTTP POST request to the given url with a provided body
 func (c Client) post(url string, body []byte) ([]byte, error) {
-	req, _ := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(body))
+	return c.postContext(context.Background(), url, body)
+}
+
+// postContext makes an HTTP POST request bound to ctx to the given url with a provided body
+func (c Client) postContext(ctx context.Context, url string, body []byte) ([]byte, error) {
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(body))
 	return c.processRequest(req)
 }
 
@@ -163,3 +180,12 @@ func (c Client) setHeaders(req *http.Request) {
 	req.Header.Set("Accept", "application/json")
 	req.Header.Set("Content-Type", "application/json")
 }
+
+// logf writes to the client's logger, or the standard logger when it has none
+func (c Client) logf(format string, args ...interface{}) {
+	if c.Logger != nil {
+		c.Logger.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
@@ -22,6 +22,7 @@ var (
 	StreamEventString    = `1460905367,65,9550.3,88,10,76,30.493001,-100.457018,,,227,184,75`
 	BadStreamEventString = `1460905367    9550.3,88    76,30.493001,-100.457018,,,227,184,75`
 	TrueJSON             = `{"response":true}`
+	VehicleDataJSON      = `{"response":{"id":123,"charge_state":{"charging_state":"Complete","battery_level":90},"climate_state":{"is_climate_on":false,"driver_temp_setting":22.0},"drive_state":{"shift_state":null,"latitude":3.6,"longitude":-149.1},"gui_settings":{"gui_distance_units":"mi/hr"},"vehicle_state":{"sentry_mode":true,"vehicle_name":"Macak"}}}`
 	VehiclesJSON         = `{"response":[{"color":null,"display_name":"Otto","id":123,"option_codes":"MDL3,RENA,AU01,BC3B,BS00,CDM0,CH07,PBCW,DA02,DCF0,DRLH,DV4W,FG31,HP00,IN3PB,LP01,ME02,MT310,PA00,PPSQ,PI01,PK00,PS01,PX00B,RFG3,SC01,SP00,SR01,SU00,TM00,TP03,W39B,X003,X007,X013,X027,X028,X031,X037,X040,YF00,","user_id":123,"vehicle_id":456,"vin":"abc123","tokens":["1","2"],"state":"online","id_s":"123","remote_start_enabled":true,"calendar_enabled":true,"notifications_enabled":true,"backseat_token":null,"backseat_token_updated_at":null}],"count":1}`
 	VehicleStateJSON     = `{"response":{"api_version":3,"calendar_supported":true,"car_type":"s","car_version":"2.9.12","center_display_state":0,"dark_rims":false,"df":0,"dr":0,"exterior_color":"Black","ft":0,"has_spoiler":true,"locked":true,"notifications_supported":true,"odometer":3738.84633,"parsed_calendar_supported":true,"perf_config":"P2","pf":0,"pr":0,"rear_seat_heaters":1,"remote_start":false,"remote_start_supported":true,"rhd":false,"roof_color":"None","rt":0,"seat_type":1,"sun_roof_installed":2,"sun_roof_percent_open":0,"sun_roof_state":"unknown","third_row_seats":"None","valet_mode":false,"vehicle_name":"Macak","wheel_type":"Super21Gray"}}`
 	WakeupResponseJSON   = `{"response":{"color":null,"display_name":"Otto","id":123,"option_codes":"MDL3,RENA,AU01,BC3B,BS00,CDM0,CH07,PBCW,DA02,DCF0,DRLH,DV4W,FG31,HP00,IN3PB,LP01,ME02,MT310,PA00,PPSQ,PI01,PK00,PS01,PX00B,RFG3,SC01,SP00,SR01,SU00,TM00,TP03,W39B,X003,X007,X013,X027,X028,X031,X037,X040,YF00,","user_id":123,"vehicle_id":456,"vin":"abc123","tokens":["1","2"],"state":"online","id_s":"123","remote_start_enabled":true,"calendar_enabled":true,"notifications_enabled":true,"backseat_token":null,"backseat_token_updated_at":null}}`
@@ -122,13 +123,20 @@ func serveHTTP(t *testing.T) *httptest.Server {
 			checkHeaders(t, req)
 			w.WriteHeader(200)
 			w.Write([]byte(VehicleStateJSON))
+		case "/api/1/vehicles/123/vehicle_data":
+			checkHeaders(t, req)
+			w.WriteHeader(200)
+			w.Write([]byte(VehicleDataJSON))
 		case "/api/1/vehicles/123/wake_up":
 			checkHeaders(t, req)
 			w.WriteHeader(200)
 			w.Write([]byte(WakeupResponseJSON))
 		case "/api/1/vehicles/123/command/set_charge_limit":
 			w.WriteHeader(200)
-			assert.Equal(t, string(body), `{"percent": 50}`)
+			assert.Equal(t, `{"percent":50}`, string(body))
+		case "/api/1/vehicles/123/command/set_charging_amps":
+			w.WriteHeader(200)
+			assert.Equal(t, `{"charging_amps":16}`, string(body))
 		case "/api/1/vehicles/123/command/charge_standard":
 			checkHeaders(t, req)
 			w.WriteHeader(200)
@@ -146,12 +154,25 @@ func serveHTTP(t *testing.T) *httptest.Server {
 			"/api/1/vehicles/123/command/auto_conditioning_stop",
 			"/api/1/vehicles/123/command/door_unlock",
 			"/api/1/vehicles/123/command/door_lock",
-			"/api/1/vehicles/123/command/reset_valet_pin",
-			"/api/1/vehicles/123/command/set_temps?driver_temp=68.1&passenger_temp=73.4",
-			"/api/1/vehicles/123/command/remote_start_drive?password=pass":
+			"/api/1/vehicles/123/command/reset_valet_pin":
 			checkHeaders(t, req)
 			w.WriteHeader(200)
 			w.Write([]byte(CommandResponseJSON))
+		case "/api/1/vehicles/123/command/set_temps":
+			checkHeaders(t, req)
+			assert.Equal(t, `{"driver_temp":20.1,"passenger_temp":23.4}`, string(body))
+			w.WriteHeader(200)
+			w.Write([]byte(CommandResponseJSON))
+		case "/api/1/vehicles/123/command/remote_start_drive":
+			checkHeaders(t, req)
+			assert.Equal(t, `{"password":"pass"}`, string(body))
+			w.WriteHeader(200)
+			w.Write([]byte(CommandResponseJSON))
+		case "/api/1/vehicles/123/command/trunk_open":
+			checkHeaders(t, req)
+			assert.Equal(t, `{"which_trunk":"rear"}`, string(body))
+			w.WriteHeader(200)
+			w.Write([]byte(CommandResponseJSON))
 		case "/stream/123/?values=speed,odometer,soc,elevation,est_heading,est_lat,est_lng,power,shift_state,range,est_range,heading":
 			w.WriteHeader(200)
 			events := StreamEventString + "\n" +
@@ -159,6 +180,9 @@ func serveHTTP(t *testing.T) *httptest.Server {
 				BadStreamEventString + "\n"
 			b := bytes.NewBufferString(events)
 			b.WriteTo(w)
+		case "/stream/123/?values=soc,speed,brake_temp":
+			w.WriteHeader(200)
+			w.Write([]byte("1460905367,88,65,41,extra\n"))
 		case "/api/1/vehicles/123/command/autopark_request":
 			w.WriteHeader(200)
 			autoParkRequest := &AutoParkRequest{}
@@ -188,16 +212,16 @@ func serveHTTP(t *testing.T) *httptest.Server {
 			w.WriteHeader(200)
 			passed := false
 			strBody := string(body)
-			if strBody == `{"state": "vent", "percent":0}` {
+			if strBody == `{"state":"vent","percent":0}` {
 				passed = true
 			}
-			if strBody == `{"state": "open", "percent":0}` {
+			if strBody == `{"state":"open","percent":0}` {
 				passed = true
 			}
-			if strBody == `{"state": "move", "percent":50}` {
+			if strBody == `{"state":"move","percent":50}` {
 				passed = true
 			}
-			if strBody == `{"state": "close", "percent":0}` {
+			if strBody == `{"state":"close","percent":0}` {
 				passed = true
 			}
 			assert.True(t, passed)
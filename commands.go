@@ -1,9 +1,13 @@
 package tesla
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"net/http"
 	"strconv"
+	"time"
 )
 
 // CommandResponse is the response to a command sent to the Tesla API
@@ -14,6 +18,9 @@ type CommandResponse struct {
 	} `json:"response"`
 }
 
+// DryRunReason is the reason given in the synthetic response to commands sent in dry run mode
+const DryRunReason = "dry_run"
+
 // AutoParkRequest respresnts a request to autopark/summon a vehicle
 type AutoParkRequest struct {
 	Action    string  `json:"action,omitempty"`
@@ -22,61 +29,149 @@ type AutoParkRequest struct {
 	VehicleID int     `json:"vehicle_id,omitempty"`
 }
 
+// ChargeLimitRequest represents a request to set the vehicle's charge limit
+type ChargeLimitRequest struct {
+	Percent int `json:"percent"`
+}
+
+// ChargingAmpsRequest represents a request to set the current the vehicle draws while charging
+type ChargingAmpsRequest struct {
+	ChargingAmps int `json:"charging_amps"`
+}
+
+// RemoteStartRequest represents a request to enable keyless driving
+type RemoteStartRequest struct {
+	Password string `json:"password"`
+}
+
+// RoofRequest represents a request to move the panoramic roof
+type RoofRequest struct {
+	State   string `json:"state"`
+	Percent int    `json:"percent"`
+}
+
+// TemperatureRequest represents a request to set the driver and passenger zone temperatures
+type TemperatureRequest struct {
+	DriverTemp    float64 `json:"driver_temp"`
+	PassengerTemp float64 `json:"passenger_temp"`
+}
+
+// TrunkRequest represents a request to open one of the vehicle's trunks
+type TrunkRequest struct {
+	WhichTrunk string `json:"which_trunk"`
+}
+
+// validator is implemented by requests that check their arguments before being sent
+type validator interface {
+	validate(v Vehicle) error
+}
+
+// validate checks the percent against the limits reported by the vehicle's charge state
+func (r ChargeLimitRequest) validate(v Vehicle) error {
+	chargeState, err := v.ChargeState()
+	if err != nil {
+		return err
+	}
+	if r.Percent < chargeState.ChargeLimitSocMin || r.Percent > chargeState.ChargeLimitSocMax {
+		return fmt.Errorf("charge limit %d outside of allowed range %d-%d", r.Percent, chargeState.ChargeLimitSocMin, chargeState.ChargeLimitSocMax)
+	}
+	return nil
+}
+
+// validate checks the current against the maximum reported by the vehicle's charge state
+func (r ChargingAmpsRequest) validate(v Vehicle) error {
+	chargeState, err := v.ChargeState()
+	if err != nil {
+		return err
+	}
+	if r.ChargingAmps < 0 || r.ChargingAmps > chargeState.ChargeCurrentRequestMax {
+		return fmt.Errorf("charging amps %d outside of allowed range 0-%d", r.ChargingAmps, chargeState.ChargeCurrentRequestMax)
+	}
+	return nil
+}
+
+// validate ensures a password is provided
+func (r RemoteStartRequest) validate(v Vehicle) error {
+	if r.Password == "" {
+		return errors.New("password is required to start the vehicle")
+	}
+	return nil
+}
+
+// validate checks the roof state is known and the percent is between 0 and 100
+func (r RoofRequest) validate(v Vehicle) error {
+	switch r.State {
+	case "open", "close", "comfort", "vent", "move":
+	default:
+		return fmt.Errorf("invalid roof state %q", r.State)
+	}
+	if r.Percent < 0 || r.Percent > 100 {
+		return fmt.Errorf("roof percent %d outside of allowed range 0-100", r.Percent)
+	}
+	return nil
+}
+
+// validate checks both temperatures against the limits reported by the vehicle's climate state
+func (r TemperatureRequest) validate(v Vehicle) error {
+	climateState, err := v.ClimateState()
+	if err != nil {
+		return err
+	}
+	for _, temp := range []float64{r.DriverTemp, r.PassengerTemp} {
+		if temp < climateState.MinAvailTemp || temp > climateState.MaxAvailTemp {
+			return fmt.Errorf("temperature %v outside of allowed range %v-%v", temp, climateState.MinAvailTemp, climateState.MaxAvailTemp)
+		}
+	}
+	return nil
+}
+
+// validate ensures the trunk is either 'front' or 'rear'
+func (r TrunkRequest) validate(v Vehicle) error {
+	if r.WhichTrunk != "front" && r.WhichTrunk != "rear" {
+		return fmt.Errorf("invalid trunk %q", r.WhichTrunk)
+	}
+	return nil
+}
+
 // AutoparkAbort tells the vehicle to abort an autopark/summon request
 func (v Vehicle) AutoparkAbort() error {
-	return v.autoPark("abort")
+	_, err := v.command("autopark_abort", nil)
+	return err
 }
 
 // AutoparkForward tells the vehicle to move forward
 func (v Vehicle) AutoparkForward() error {
-	return v.autoPark("start_forward")
+	_, err := v.command("autopark_forward", nil)
+	return err
 }
 
 // AutoparkReverse tells the vehicle to move backwards
 func (v Vehicle) AutoparkReverse() error {
-	return v.autoPark("start_reverse")
-}
-
-func (v Vehicle) autoPark(action string) error {
-	url := BaseURL + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/autopark_request"
-	driveState, _ := v.DriveState()
-	autoParkRequest := &AutoParkRequest{
-		VehicleID: v.VehicleID,
-		Lat:       driveState.Latitude,
-		Lon:       driveState.Longitude,
-		Action:    action,
-	}
-	body, _ := json.Marshal(autoParkRequest)
-
-	_, err := sendCommand(url, body)
+	_, err := v.command("autopark_reverse", nil)
 	return err
 }
 
 // FlashLights flashes the vehicle's lights
 func (v Vehicle) FlashLights() error {
-	url := BaseURL + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/flash_lights"
-	_, err := sendCommand(url, nil)
+	_, err := v.command("flash_lights", nil)
 	return err
 }
 
 // HonkHorn honks the vehicle's horn
 func (v *Vehicle) HonkHorn() error {
-	url := BaseURL + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/honk_horn"
-	_, err := sendCommand(url, nil)
+	_, err := v.command("honk_horn", nil)
 	return err
 }
 
 // LockDoors locks the vehicle's doors
 func (v Vehicle) LockDoors() error {
-	url := BaseURL + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/door_lock"
-	_, err := sendCommand(url, nil)
+	_, err := v.command("door_lock", nil)
 	return err
 }
 
 // UnlockDoors unlocks the vehicle's doors
 func (v Vehicle) UnlockDoors() error {
-	url := BaseURL + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/door_unlock"
-	_, err := sendCommand(url, nil)
+	_, err := v.command("door_unlock", nil)
 	return err
 }
 
@@ -84,118 +179,97 @@ func (v Vehicle) UnlockDoors() error {
 // Each state and percentage: open = 100%, close = 0%, comfort = 80%, vent = %15
 // To set a custom percentage provide a state of "move" along with a custom percentage.
 func (v Vehicle) MoveRoof(state string, percent int) error {
-	url := BaseURL + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/sun_roof_control"
-	payload := `{"state": "` + state + `", "percent":` + strconv.Itoa(percent) + `}`
-	_, err := ActiveClient.post(url, []byte(payload))
+	_, err := v.command("sun_roof_control", &RoofRequest{State: state, Percent: percent})
 	return err
 }
 
 // OpenChargePort tells the vehicle to open the charge port
 func (v Vehicle) OpenChargePort() error {
-	url := BaseURL + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/charge_port_door_open"
-	_, err := sendCommand(url, nil)
+	_, err := v.command("charge_port_door_open", nil)
 	return err
 }
 
 // OpenTrunk opens the specified trunk; possible values: 'front', 'rear'
 func (v Vehicle) OpenTrunk(trunk string) error {
-	url := BaseURL + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/trunk_open" // ?which_trunk=" + trunk
-	payload := `{"which_trunk": "` + trunk + `"}`
-	_, err := ActiveClient.post(url, []byte(payload))
+	_, err := v.command("trunk_open", &TrunkRequest{WhichTrunk: trunk})
 	return err
 }
 
 // ResetValetPIN resets the valet mode PIN
 func (v Vehicle) ResetValetPIN() error {
-	url := BaseURL + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/reset_valet_pin"
-	_, err := sendCommand(url, nil)
+	_, err := v.command("reset_valet_pin", nil)
 	return err
 }
 
 // SetChargeLimit sets the vehicle's charge limit to a specific percentage
 func (v Vehicle) SetChargeLimit(percent int) error {
-	url := BaseURL + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/set_charge_limit"
-	payload := `{"percent": ` + strconv.Itoa(percent) + `}`
-	_, err := ActiveClient.post(url, []byte(payload))
+	_, err := v.command("set_charge_limit", &ChargeLimitRequest{Percent: percent})
 	return err
 }
 
 // SetChargeLimitMax sets the vehicle's charge limit to the max
 func (v Vehicle) SetChargeLimitMax() error {
-	url := BaseURL + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/charge_max_range"
-	_, err := sendCommand(url, nil)
+	_, err := v.command("charge_max_range", nil)
 	return err
 }
 
 // SetChargeLimitStandard sets the vehicle's charge limit to the default standard
 func (v Vehicle) SetChargeLimitStandard() error {
-	url := BaseURL + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/charge_standard"
-	_, err := sendCommand(url, nil)
+	_, err := v.command("charge_standard", nil)
+	return err
+}
+
+// SetChargingAmps sets the current the vehicle draws while charging
+func (v Vehicle) SetChargingAmps(amps int) error {
+	_, err := v.command("set_charging_amps", &ChargingAmpsRequest{ChargingAmps: amps})
 	return err
 }
 
 // SetTemperature sets the driver and passenger zone temperatures
 func (v Vehicle) SetTemperature(driver float64, passenger float64) error {
-	driverTemp := strconv.FormatFloat(driver, 'f', -1, 32)
-	passengerTemp := strconv.FormatFloat(passenger, 'f', -1, 32)
-	url := BaseURL + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/set_temps?driver_temp=" + driverTemp + "&passenger_temp=" + passengerTemp
-	_, err := ActiveClient.post(url, nil)
+	_, err := v.command("set_temps", &TemperatureRequest{DriverTemp: driver, PassengerTemp: passenger})
 	return err
 }
 
 // Start starts the vehicle
 func (v Vehicle) Start(password string) error {
-	url := BaseURL + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/remote_start_drive?password=" + password
-	_, err := sendCommand(url, nil)
+	_, err := v.command("remote_start_drive", &RemoteStartRequest{Password: password})
 	return err
 }
 
 // StartAirConditioning starts the vehicle's AC
 func (v Vehicle) StartAirConditioning() error {
-	url := BaseURL + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/auto_conditioning_start"
-	_, err := sendCommand(url, nil)
+	_, err := v.command("auto_conditioning_start", nil)
 	return err
 }
 
 // StopAirConditioning stops the vehicle's AC
 func (v Vehicle) StopAirConditioning() error {
-	url := BaseURL + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/auto_conditioning_stop"
-	_, err := sendCommand(url, nil)
+	_, err := v.command("auto_conditioning_stop", nil)
 	return err
 }
 
 // StartCharging tells the vehicle to start charging
 func (v Vehicle) StartCharging() error {
-	url := BaseURL + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/charge_start"
-	_, err := sendCommand(url, nil)
+	_, err := v.command("charge_start", nil)
 	return err
 }
 
 // StopCharging tells the vehicle to stop charging
 func (v Vehicle) StopCharging() error {
-	url := BaseURL + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/charge_stop"
-	_, err := sendCommand(url, nil)
+	_, err := v.command("charge_stop", nil)
 	return err
 }
 
 // ToggleHomelink tells the vehicle to toggle Homelink garage door opener
 func (v Vehicle) ToggleHomelink() error {
-	url := BaseURL + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/command/trigger_homelink"
-	driveState, _ := v.DriveState()
-	autoParkRequest := &AutoParkRequest{
-		Lat: driveState.Latitude,
-		Lon: driveState.Longitude,
-	}
-	body, _ := json.Marshal(autoParkRequest)
-
-	_, err := sendCommand(url, body)
+	_, err := v.command("trigger_homelink", nil)
 	return err
 }
 
 // Wakeup wakes up a vehicle that is powered off
 func (v Vehicle) Wakeup() (*Vehicle, error) {
-	url := BaseURL + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/wake_up"
-	body, err := sendCommand(url, nil)
+	body, err := v.command("wake_up", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -207,9 +281,104 @@ func (v Vehicle) Wakeup() (*Vehicle, error) {
 	return vehicleResponse.Response, nil
 }
 
+// command sends the named command from the registry with the given payload.
+// Commands that take arguments get an empty payload when none is provided.
+// Capabilities are checked as by Execute, so Start fails without remote start
+// enabled and MoveRoof reads the vehicle's state first to find its sun roof.
+func (v Vehicle) command(name string, payload interface{}) ([]byte, error) {
+	cmd, ok := LookupCommand(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown command %q", name)
+	}
+	if payload == nil && cmd.Payload != nil {
+		payload = cmd.Payload()
+	}
+	return v.send(context.Background(), cmd, payload)
+}
+
+// send delivers the command and records the attempt with the client's audit
+// sink, if any. Audit failures are logged rather than returned, as the command
+// has already been sent and callers would otherwise retry it.
+func (v Vehicle) send(ctx context.Context, cmd Command, payload interface{}) ([]byte, error) {
+	start := time.Now()
+	body, err := v.deliver(ctx, cmd, payload)
+	if ActiveClient.Audit != nil {
+		entry := newAuditEntry(v, cmd, payload, body, err, start)
+		if auditErr := ActiveClient.Audit.Record(entry); auditErr != nil {
+			ActiveClient.logf("command %q not audited: %v", cmd.Name, auditErr)
+		}
+	}
+	return body, err
+}
+
+// deliver checks the client's policy and the vehicle's capabilities, then prepares, validates and sends the
+// payload as the JSON body of the command. When the client has verification
+// enabled, commands that support it wait until the vehicle's state reflects them.
+func (v Vehicle) deliver(ctx context.Context, cmd Command, payload interface{}) ([]byte, error) {
+	if ActiveClient.Policy != nil {
+		if err := ActiveClient.Policy.Evaluate(v, cmd.Name); err != nil {
+			return nil, err
+		}
+	}
+	err := v.checkCapabilities(cmd)
+	if err != nil {
+		return nil, err
+	}
+	var body []byte
+	if payload != nil {
+		if cmd.prepare != nil {
+			if err = cmd.prepare(v, payload); err != nil {
+				return nil, err
+			}
+		}
+		if r, ok := payload.(validator); ok {
+			if err = r.validate(v); err != nil {
+				return nil, err
+			}
+		}
+		body, err = json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if ActiveClient.DryRun {
+		return v.dryRun(cmd, payload)
+	}
+	res, err := sendCommand(ctx, v.commandURL(cmd.Endpoint), body)
+	if err != nil {
+		return nil, err
+	}
+	if ActiveClient.Verify != nil && cmd.verify != nil {
+		if err = v.verifyCommand(ctx, cmd, payload, ActiveClient.Verify); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// dryRun logs the request the command would send, with sensitive arguments
+// redacted as in audit entries, and returns a synthetic successful response in its place
+func (v Vehicle) dryRun(cmd Command, payload interface{}) ([]byte, error) {
+	var body []byte
+	if args := sanitizeArgs(payload); args != nil {
+		body, _ = json.Marshal(args)
+	}
+	ActiveClient.logf("dry run: %s %s %s", http.MethodPost, v.commandURL(cmd.Endpoint), body)
+	if cmd.Name == "wake_up" {
+		// wake_up responds with the vehicle rather than a command result
+		return json.Marshal(&VehicleResponse{Response: &v})
+	}
+	return []byte(`{"response":{"reason":"` + DryRunReason + `","result":true}}`), nil
+}
+
+// commandURL returns the URL of a command endpoint for the vehicle
+func (v Vehicle) commandURL(endpoint string) string {
+	return BaseURL + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/" + endpoint
+}
+
 // Sends a command to the vehicle
-func sendCommand(url string, reqBody []byte) ([]byte, error) {
-	body, err := ActiveClient.post(url, reqBody)
+func sendCommand(ctx context.Context, url string, reqBody []byte) ([]byte, error) {
+	body, err := ActiveClient.postContext(ctx, url, reqBody)
 	if err != nil {
 		return nil, err
 	}
@@ -1,6 +1,14 @@
 package tesla
 
 import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -54,6 +62,15 @@ func TestCommands(t *testing.T) {
 	err = vehicle.SetChargeLimit(50)
 	assert.Nil(t, err)
 
+	err = vehicle.SetChargeLimit(40)
+	assert.Equal(t, "charge limit 40 outside of allowed range 50-100", err.Error())
+
+	err = vehicle.SetChargingAmps(16)
+	assert.Nil(t, err)
+
+	err = vehicle.SetChargingAmps(48)
+	assert.Equal(t, "charging amps 48 outside of allowed range 0-40", err.Error())
+
 	err = vehicle.SetChargeLimitStandard()
 	assert.Equal(t, "already_standard", err.Error())
 
@@ -78,12 +95,24 @@ func TestCommands(t *testing.T) {
 	err = vehicle.LockDoors()
 	assert.Nil(t, err)
 
-	err = vehicle.SetTemperature(68.1, 73.4)
+	err = vehicle.SetTemperature(20.1, 23.4)
 	assert.Nil(t, err)
 
+	err = vehicle.SetTemperature(68.1, 73.4)
+	assert.Equal(t, "temperature 68.1 outside of allowed range 15-28", err.Error())
+
 	err = vehicle.Start("pass")
 	assert.Nil(t, err)
 
+	err = vehicle.Start("")
+	assert.Equal(t, "password is required to start the vehicle", err.Error())
+
+	err = vehicle.OpenTrunk("rear")
+	assert.Nil(t, err)
+
+	err = vehicle.OpenTrunk("side")
+	assert.Equal(t, `invalid trunk "side"`, err.Error())
+
 	err = vehicle.MoveRoof("vent", 0)
 	assert.Nil(t, err)
 
@@ -96,5 +125,75 @@ func TestCommands(t *testing.T) {
 	err = vehicle.MoveRoof("close", 0)
 	assert.Nil(t, err)
 
+	err = vehicle.MoveRoof("move", 150)
+	assert.Equal(t, "roof percent 150 outside of allowed range 0-100", err.Error())
+
+	err = vehicle.MoveRoof("tilt", 0)
+	assert.Equal(t, `invalid roof state "tilt"`, err.Error())
+
+	BaseURL = previousURL
+}
+
+func TestDryRun(t *testing.T) {
+	ts := serveHTTP(t)
+	defer ts.Close()
+	target, _ := url.Parse(ts.URL)
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	var commands int
+	counter := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if strings.Contains(req.URL.Path, "/command/") || strings.HasSuffix(req.URL.Path, "/wake_up") {
+			commands++
+		}
+		proxy.ServeHTTP(w, req)
+	}))
+	defer counter.Close()
+	previousURL := BaseURL
+	BaseURL = counter.URL + "/api/1"
+
+	auth := &Auth{
+		GrantType:    "password",
+		ClientID:     "someclient123",
+		ClientSecret: "somesecret456",
+		Email:        "nobody@example.com",
+		Password:     "pass",
+	}
+	client, _ := NewClient(auth)
+	var out bytes.Buffer
+	client.DryRun = true
+	client.Logger = log.New(&out, "", 0)
+	vehicles, err := client.Vehicles()
+	assert.Nil(t, err)
+	vehicle := vehicles[0]
+
+	assert.Nil(t, vehicle.AutoparkForward())
+	assert.Contains(t, out.String(), "dry run: POST "+BaseURL+"/vehicles/123/command/autopark_request ")
+	assert.Contains(t, out.String(), `"action":"start_forward"`)
+
+	// passwords are redacted as in audit entries
+	out.Reset()
+	assert.Nil(t, vehicle.Start("secret123"))
+	assert.Contains(t, out.String(), `{"password":"[REDACTED]"}`)
+	assert.NotContains(t, out.String(), "secret123")
+
+	response, err := vehicle.Execute(context.Background(), "door_unlock", nil)
+	assert.Nil(t, err)
+	assert.True(t, response.Response.Result)
+	assert.Equal(t, DryRunReason, response.Response.Reason)
+
+	// the real endpoint would fail with already_standard
+	assert.Nil(t, vehicle.SetChargeLimitStandard())
+
+	woken, err := vehicle.Wakeup()
+	assert.Nil(t, err)
+	assert.Equal(t, vehicle.ID, woken.ID)
+
+	// validation still reads state and rejects bad arguments
+	assert.NotNil(t, vehicle.SetChargeLimit(10))
+
+	chargeState, err := vehicle.ChargeState()
+	assert.Nil(t, err)
+	assert.Equal(t, 90, chargeState.BatteryLevel)
+	assert.Equal(t, 0, commands)
+
 	BaseURL = previousURL
 }
@@ -0,0 +1,161 @@
+package tesla
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a cron schedule of five fields: minute, hour, day of month, month
+// and day of week. Fields accept "*", numbers, ranges such as "1-5", steps such
+// as "*/15" and comma separated lists of these; days of the week may also be
+// given by name, such as "mon-fri". As in cron, when both the day of month and
+// the day of week are restricted, a day matching either one matches; a field is
+// restricted unless it starts with "*", so "1-31" or "0-6" match either way.
+type Schedule struct {
+	spec    string
+	minutes uint64
+	hours   uint64
+	days    uint64
+	months  uint64
+	weekday uint64
+	anyDay  bool
+	anyWeek bool
+}
+
+// scheduleSearchLimit bounds the search for the next time a schedule matches
+const scheduleSearchLimit = 5 * 366 * 24 * time.Hour
+
+// ParseSchedule parses a five field cron schedule
+func ParseSchedule(spec string) (*Schedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule %q: expected 5 fields", spec)
+	}
+	s := &Schedule{spec: spec}
+	var err error
+	if s.minutes, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: %v", spec, err)
+	}
+	if s.hours, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: %v", spec, err)
+	}
+	if s.days, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: %v", spec, err)
+	}
+	if s.months, err = parseCronField(fields[3], 1, 12, nil); err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: %v", spec, err)
+	}
+	if s.weekday, err = parseCronField(fields[4], 0, 7, weekdays); err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: %v", spec, err)
+	}
+	// 7 is another name for Sunday
+	if s.weekday&(1<<7) != 0 {
+		s.weekday |= 1
+	}
+	// as in cron, only fields starting with "*" are unrestricted, whatever they cover
+	s.anyDay = strings.HasPrefix(fields[2], "*")
+	s.anyWeek = strings.HasPrefix(fields[4], "*")
+	return s, nil
+}
+
+func (s *Schedule) String() string {
+	return s.spec
+}
+
+// Matches reports whether the schedule fires in the minute of t, in t's location
+func (s *Schedule) Matches(t time.Time) bool {
+	return s.matchesDay(t) && s.hours&(1<<uint(t.Hour())) != 0 && s.minutes&(1<<uint(t.Minute())) != 0
+}
+
+// Next returns the start of the first minute after t in which the schedule
+// fires, in t's location, or the zero time if it never fires
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(scheduleSearchLimit)
+	for t.Before(limit) {
+		if !s.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hours&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minutes&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (s *Schedule) matchesDay(t time.Time) bool {
+	if s.months&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+	day := s.days&(1<<uint(t.Day())) != 0
+	week := s.weekday&(1<<uint(t.Weekday())) != 0
+	switch {
+	case s.anyDay && s.anyWeek:
+		return true
+	case s.anyDay:
+		return week
+	case s.anyWeek:
+		return day
+	}
+	return day || week
+}
+
+// parseCronField returns a bit set of the values matched by a schedule field
+func parseCronField(field string, min, max int, names map[string]time.Weekday) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			part = part[:i]
+		}
+
+		start, end := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if start, err = parseCronValue(bounds[0], names); err != nil {
+				return 0, err
+			}
+			end = start
+			if len(bounds) == 2 {
+				if end, err = parseCronValue(bounds[1], names); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				end = max
+			}
+		}
+		if start < min || end > max || start > end {
+			return 0, fmt.Errorf("%q is out of range %d-%d", part, min, max)
+		}
+		for value := start; value <= end; value += step {
+			bits |= 1 << uint(value)
+		}
+	}
+	return bits, nil
+}
+
+func parseCronValue(value string, names map[string]time.Weekday) (int, error) {
+	if day, ok := names[strings.ToLower(value)]; ok {
+		return int(day), nil
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", value)
+	}
+	return i, nil
+}
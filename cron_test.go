@@ -0,0 +1,54 @@
+package tesla
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchedule(t *testing.T) {
+	// Monday 18 April 2016
+	monday := time.Date(2016, 4, 18, 7, 39, 30, 0, time.UTC)
+
+	schedule, err := ParseSchedule("40 7 * * mon-fri")
+	assert.Nil(t, err)
+	assert.Equal(t, "40 7 * * mon-fri", schedule.String())
+	assert.False(t, schedule.Matches(monday))
+	assert.True(t, schedule.Matches(monday.Add(time.Minute)))
+	assert.Equal(t, time.Date(2016, 4, 18, 7, 40, 0, 0, time.UTC), schedule.Next(monday))
+	assert.Equal(t, time.Date(2016, 4, 19, 7, 40, 0, 0, time.UTC), schedule.Next(monday.Add(time.Minute)))
+	// Friday skips to Monday
+	assert.Equal(t, time.Date(2016, 4, 25, 7, 40, 0, 0, time.UTC), schedule.Next(time.Date(2016, 4, 22, 8, 0, 0, 0, time.UTC)))
+
+	schedule, err = ParseSchedule("*/15 22-23,0-5 * * *")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2016, 4, 18, 22, 0, 0, 0, time.UTC), schedule.Next(monday))
+	assert.Equal(t, time.Date(2016, 4, 19, 0, 0, 0, 0, time.UTC), schedule.Next(time.Date(2016, 4, 18, 23, 45, 0, 0, time.UTC)))
+	assert.True(t, schedule.Matches(time.Date(2016, 4, 18, 5, 30, 0, 0, time.UTC)))
+
+	// the day of month or the day of week may match when both are restricted
+	schedule, err = ParseSchedule("0 12 1 * 7")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2016, 4, 24, 12, 0, 0, 0, time.UTC), schedule.Next(monday))
+	assert.Equal(t, time.Date(2016, 5, 1, 12, 0, 0, 0, time.UTC), schedule.Next(time.Date(2016, 4, 24, 12, 0, 0, 0, time.UTC)))
+
+	// a day of week starting with "*" is unrestricted
+	schedule, err = ParseSchedule("0 12 1 * */1")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2016, 5, 1, 12, 0, 0, 0, time.UTC), schedule.Next(monday))
+	// other fields are restricted even when they cover every day, so any day matches
+	for _, spec := range []string{"0 12 1 * 0-6", "0 12 1 * 1-7", "0 12 1-31 * sun"} {
+		schedule, err = ParseSchedule(spec)
+		assert.Nil(t, err)
+		assert.Equal(t, time.Date(2016, 4, 18, 12, 0, 0, 0, time.UTC), schedule.Next(monday), spec)
+	}
+
+	schedule, _ = ParseSchedule("0 0 30 2 *")
+	assert.True(t, schedule.Next(monday).IsZero())
+
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "* * * * someday"} {
+		_, err = ParseSchedule(spec)
+		assert.NotNil(t, err, spec)
+	}
+}
@@ -0,0 +1,269 @@
+package tesla
+
+import (
+	"reflect"
+	"strings"
+)
+
+// StateSnapshot holds the states of a vehicle read at one point in time. States
+// that were not read are nil and are not compared.
+type StateSnapshot struct {
+	ChargeState  *ChargeState
+	ClimateState *ClimateState
+	DriveState   *DriveState
+	VehicleState *VehicleState
+}
+
+// Change is a single field whose value differs between two snapshots. Field is
+// the state's JSON name and the field's JSON name, e.g. "charge_state.battery_level".
+type Change struct {
+	Field  string
+	Before interface{}
+	After  interface{}
+}
+
+// StateEvent is a notable change in a vehicle's state. It is one of
+// *ChargingStarted, *ChargingComplete, *Unlocked, *SentryTriggered,
+// *ShiftChanged or *LocationChanged.
+type StateEvent interface {
+	stateEvent()
+}
+
+// ChargingStarted is reported when the charging state becomes "Charging"
+type ChargingStarted struct {
+	Before       string
+	After        string
+	BatteryLevel int
+}
+
+// ChargingComplete is reported when the charging state becomes "Complete"
+type ChargingComplete struct {
+	Before            string
+	After             string
+	BatteryLevel      int
+	ChargeEnergyAdded float64
+}
+
+// Unlocked is reported when the vehicle's doors are unlocked
+type Unlocked struct {
+	Before bool
+	After  bool
+}
+
+// SentryTriggered is reported when, with sentry mode on, the center display
+// enters the sentry display state, which it does when sentry mode detects
+// someone near the vehicle. This is a heuristic: the API does not report
+// sentry events or alarms, so it only reflects the display.
+type SentryTriggered struct {
+	Before int
+	After  int
+}
+
+// ShiftChanged is reported when the shift state changes; an empty shift state
+// means the vehicle is parked and asleep or not reporting it
+type ShiftChanged struct {
+	Before string
+	After  string
+}
+
+// LocationChanged is reported when the vehicle has moved further than the
+// location threshold; Distance is in meters
+type LocationChanged struct {
+	Before   Location
+	After    Location
+	Distance float64
+}
+
+func (*ChargingStarted) stateEvent()  {}
+func (*ChargingComplete) stateEvent() {}
+func (*Unlocked) stateEvent()         {}
+func (*SentryTriggered) stateEvent()  {}
+func (*ShiftChanged) stateEvent()     {}
+func (*LocationChanged) stateEvent()  {}
+
+// sentryDisplayState is the center display state of the sentry display
+const sentryDisplayState = 7
+
+// StateDiff lists the field changes and the events detected between two snapshots
+type StateDiff struct {
+	Changes []Change
+	Events  []StateEvent
+}
+
+// DiffOptions configures the detection of state events
+type DiffOptions struct {
+	// LocationThreshold is the distance in meters the vehicle must move before a
+	// LocationChanged event is reported; defaults to 100 meters
+	LocationThreshold float64
+}
+
+var defaultLocationThreshold = 100.0
+
+// DiffStates compares two snapshots of a vehicle
+func DiffStates(before, after *StateSnapshot, opts *DiffOptions) *StateDiff {
+	var anchor *Location
+	if before != nil && before.DriveState != nil {
+		anchor = driveLocation(before.DriveState)
+	}
+	diff, _ := diffStates(before, after, anchor, locationThreshold(opts))
+	return diff
+}
+
+// StateDiffer compares each snapshot with the vehicle's last known states.
+// States missing from a snapshot keep their last known value, and locations
+// are compared with where the vehicle was when it last reported moving, so
+// that slow drifts are reported once they exceed the threshold.
+type StateDiffer struct {
+	threshold float64
+	last      StateSnapshot
+	anchor    *Location
+}
+
+// NewStateDiffer creates a differ with no known states
+func NewStateDiffer(opts *DiffOptions) *StateDiffer {
+	return &StateDiffer{threshold: locationThreshold(opts)}
+}
+
+// Update compares the snapshot with the last known states and remembers it
+func (d *StateDiffer) Update(snapshot *StateSnapshot) *StateDiff {
+	last := d.last
+	diff, moved := diffStates(&last, snapshot, d.anchor, d.threshold)
+	d.last.merge(snapshot)
+	if snapshot.DriveState != nil && (d.anchor == nil || moved) {
+		d.anchor = driveLocation(snapshot.DriveState)
+	}
+	return diff
+}
+
+// merge replaces the states that were read in the other snapshot
+func (s *StateSnapshot) merge(other *StateSnapshot) {
+	if other.ChargeState != nil {
+		s.ChargeState = other.ChargeState
+	}
+	if other.ClimateState != nil {
+		s.ClimateState = other.ClimateState
+	}
+	if other.DriveState != nil {
+		s.DriveState = other.DriveState
+	}
+	if other.VehicleState != nil {
+		s.VehicleState = other.VehicleState
+	}
+}
+
+// field returns the value of a field named as in Change, such as
+// "charge_state.battery_level". It reports false if the state was not read or
+// has no such field.
+func (s *StateSnapshot) field(name string) (interface{}, bool) {
+	parts := strings.SplitN(name, ".", 2)
+	if len(parts) != 2 {
+		return nil, false
+	}
+	var state interface{}
+	switch parts[0] {
+	case "charge_state":
+		state = s.ChargeState
+	case "climate_state":
+		state = s.ClimateState
+	case "drive_state":
+		state = s.DriveState
+	case "vehicle_state":
+		state = s.VehicleState
+	}
+	value := reflect.ValueOf(state)
+	if !value.IsValid() || value.IsNil() {
+		return nil, false
+	}
+	value = value.Elem()
+	for i := 0; i < value.NumField(); i++ {
+		if strings.Split(value.Type().Field(i).Tag.Get("json"), ",")[0] == parts[1] {
+			return value.Field(i).Interface(), true
+		}
+	}
+	return nil, false
+}
+
+// diffStates compares the snapshots, measuring movement from the anchor. It
+// reports whether a LocationChanged event was detected.
+func diffStates(before, after *StateSnapshot, anchor *Location, threshold float64) (*StateDiff, bool) {
+	diff := &StateDiff{}
+	if before == nil || after == nil {
+		return diff, false
+	}
+	if before.ChargeState != nil && after.ChargeState != nil {
+		diff.compare("charge_state", before.ChargeState, after.ChargeState)
+		b, a := before.ChargeState, after.ChargeState
+		if b.ChargingState != a.ChargingState {
+			switch a.ChargingState {
+			case "Charging":
+				diff.Events = append(diff.Events, &ChargingStarted{Before: b.ChargingState, After: a.ChargingState, BatteryLevel: a.BatteryLevel})
+			case "Complete":
+				diff.Events = append(diff.Events, &ChargingComplete{Before: b.ChargingState, After: a.ChargingState, BatteryLevel: a.BatteryLevel, ChargeEnergyAdded: a.ChargeEnergyAdded})
+			}
+		}
+	}
+	if before.ClimateState != nil && after.ClimateState != nil {
+		diff.compare("climate_state", before.ClimateState, after.ClimateState)
+	}
+	if before.VehicleState != nil && after.VehicleState != nil {
+		diff.compare("vehicle_state", before.VehicleState, after.VehicleState)
+		b, a := before.VehicleState, after.VehicleState
+		if b.Locked && !a.Locked {
+			diff.Events = append(diff.Events, &Unlocked{Before: b.Locked, After: a.Locked})
+		}
+		if a.SentryMode && b.CenterDisplayState != sentryDisplayState && a.CenterDisplayState == sentryDisplayState {
+			diff.Events = append(diff.Events, &SentryTriggered{Before: b.CenterDisplayState, After: a.CenterDisplayState})
+		}
+	}
+
+	var moved bool
+	if before.DriveState != nil && after.DriveState != nil {
+		diff.compare("drive_state", before.DriveState, after.DriveState)
+		b, a := shiftState(before.DriveState), shiftState(after.DriveState)
+		if b != a {
+			diff.Events = append(diff.Events, &ShiftChanged{Before: b, After: a})
+		}
+		if to := driveLocation(after.DriveState); anchor != nil && to != nil {
+			distance := distanceMeters(anchor.Latitude, anchor.Longitude, to.Latitude, to.Longitude)
+			if distance > threshold {
+				diff.Events = append(diff.Events, &LocationChanged{Before: *anchor, After: *to, Distance: distance})
+				moved = true
+			}
+		}
+	}
+	return diff, moved
+}
+
+// compare appends a change for each field that differs between two states of the same type
+func (d *StateDiff) compare(prefix string, before, after interface{}) {
+	b, a := reflect.ValueOf(before).Elem(), reflect.ValueOf(after).Elem()
+	for i := 0; i < b.NumField(); i++ {
+		bf, af := b.Field(i).Interface(), a.Field(i).Interface()
+		if reflect.DeepEqual(bf, af) {
+			continue
+		}
+		name := strings.Split(b.Type().Field(i).Tag.Get("json"), ",")[0]
+		d.Changes = append(d.Changes, Change{Field: prefix + "." + name, Before: bf, After: af})
+	}
+}
+
+// shiftState returns the shift state as a string, which is empty when the API reports null
+func shiftState(state *DriveState) string {
+	shift, _ := state.ShiftState.(string)
+	return shift
+}
+
+// driveLocation returns the location of the drive state, or nil if it has none
+func driveLocation(state *DriveState) *Location {
+	if state.Latitude == 0 && state.Longitude == 0 {
+		return nil
+	}
+	return &Location{Latitude: state.Latitude, Longitude: state.Longitude}
+}
+
+func locationThreshold(opts *DiffOptions) float64 {
+	if opts != nil && opts.LocationThreshold > 0 {
+		return opts.LocationThreshold
+	}
+	return defaultLocationThreshold
+}
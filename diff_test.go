@@ -0,0 +1,63 @@
+package tesla
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffStates(t *testing.T) {
+	before := &StateSnapshot{
+		ChargeState:  &ChargeState{ChargingState: "Stopped", BatteryLevel: 50},
+		DriveState:   &DriveState{Latitude: 30, Longitude: -100},
+		VehicleState: &VehicleState{Locked: true, SentryMode: true},
+	}
+	after := &StateSnapshot{
+		ChargeState:  &ChargeState{ChargingState: "Charging", BatteryLevel: 51},
+		DriveState:   &DriveState{Latitude: 30.0005, Longitude: -100, ShiftState: "D"},
+		VehicleState: &VehicleState{Locked: false, SentryMode: true, CenterDisplayState: 7},
+	}
+
+	diff := DiffStates(before, after, nil)
+	assert.Equal(t, []StateEvent{
+		&ChargingStarted{Before: "Stopped", After: "Charging", BatteryLevel: 51},
+		&Unlocked{Before: true, After: false},
+		&SentryTriggered{Before: 0, After: 7},
+		&ShiftChanged{Before: "", After: "D"},
+	}, diff.Events)
+	assert.Contains(t, diff.Changes, Change{Field: "charge_state.battery_level", Before: 50, After: 51})
+	assert.Contains(t, diff.Changes, Change{Field: "vehicle_state.locked", Before: true, After: false})
+	assert.Contains(t, diff.Changes, Change{Field: "drive_state.shift_state", Before: nil, After: "D"})
+	assert.Len(t, diff.Changes, 6)
+
+	// other display states, and the sentry display without sentry mode, are not reported
+	for _, display := range []*VehicleState{{SentryMode: true, CenterDisplayState: 2}, {CenterDisplayState: 7}} {
+		diff = DiffStates(&StateSnapshot{VehicleState: &VehicleState{}}, &StateSnapshot{VehicleState: display}, nil)
+		assert.Empty(t, diff.Events)
+	}
+
+	// states missing from either snapshot are not compared
+	diff = DiffStates(before, &StateSnapshot{ChargeState: before.ChargeState}, nil)
+	assert.Empty(t, diff.Changes)
+	assert.Empty(t, diff.Events)
+
+	differ := NewStateDiffer(&DiffOptions{LocationThreshold: 100})
+	assert.Empty(t, differ.Update(before).Events)
+	// a slow drift is reported once it exceeds the threshold from where the vehicle last moved
+	for _, latitude := range []float64{30.0003, 30.0006} {
+		diff = differ.Update(&StateSnapshot{DriveState: &DriveState{Latitude: latitude, Longitude: -100}})
+		assert.Empty(t, diff.Events)
+	}
+	diff = differ.Update(&StateSnapshot{DriveState: &DriveState{Latitude: 30.001, Longitude: -100}})
+	if assert.Len(t, diff.Events, 1) {
+		moved := diff.Events[0].(*LocationChanged)
+		assert.Equal(t, Location{Latitude: 30, Longitude: -100}, moved.Before)
+		assert.Equal(t, Location{Latitude: 30.001, Longitude: -100}, moved.After)
+		assert.InDelta(t, 111, moved.Distance, 1)
+	}
+	assert.Empty(t, differ.Update(&StateSnapshot{DriveState: &DriveState{Latitude: 30.0015, Longitude: -100}}).Events)
+
+	// the charge state kept from the first snapshot is compared with the new one
+	diff = differ.Update(&StateSnapshot{ChargeState: &ChargeState{ChargingState: "Complete", BatteryLevel: 90, ChargeEnergyAdded: 20}})
+	assert.Equal(t, []StateEvent{&ChargingComplete{Before: "Stopped", After: "Complete", BatteryLevel: 90, ChargeEnergyAdded: 20}}, diff.Events)
+}
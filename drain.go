@@ -0,0 +1,290 @@
+package tesla
+
+import "time"
+
+// DrainCondition is what the vehicle was doing while parked
+type DrainCondition string
+
+const (
+	// DrainAsleep is time spent asleep or offline
+	DrainAsleep DrainCondition = "asleep"
+	// DrainAwake is time spent online without sentry mode or climate control, such
+	// as when polling or an app keeps the vehicle awake
+	DrainAwake DrainCondition = "awake"
+	// DrainSentry is time spent online with sentry mode on
+	DrainSentry DrainCondition = "sentry"
+	// DrainClimate is time spent online with climate control on
+	DrainClimate DrainCondition = "climate"
+)
+
+// DrainPeriod is the time spent in a condition during a parked session and the
+// charge lost meanwhile. Range is in miles.
+type DrainPeriod struct {
+	Duration  time.Duration `json:"duration"`
+	LevelLost float64       `json:"level_lost"`
+	RangeLost float64       `json:"range_lost"`
+}
+
+// LevelPerHour returns the battery level lost per hour
+func (p *DrainPeriod) LevelPerHour() float64 {
+	return perHour(p.LevelLost, p.Duration)
+}
+
+// RangePerHour returns the range lost per hour
+func (p *DrainPeriod) RangePerHour() float64 {
+	return perHour(p.RangeLost, p.Duration)
+}
+
+// DrainSession is the time a vehicle spent parked and not charging, measured
+// between the first and last battery readings. Range is in miles.
+type DrainSession struct {
+	Start      time.Time                       `json:"start"`
+	End        time.Time                       `json:"end"`
+	Location   *Location                       `json:"location"`
+	StartLevel int                             `json:"start_level"`
+	EndLevel   int                             `json:"end_level"`
+	StartRange float64                         `json:"start_range"`
+	EndRange   float64                         `json:"end_range"`
+	Periods    map[DrainCondition]*DrainPeriod `json:"periods"`
+	// Abnormal is set when the session lost more than expected or the vehicle
+	// was kept awake, as described by Reasons
+	Abnormal bool     `json:"abnormal"`
+	Reasons  []string `json:"reasons,omitempty"`
+}
+
+// Duration of the session
+func (s *DrainSession) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// LevelPerHour returns the battery level lost per hour over the whole session
+func (s *DrainSession) LevelPerHour() float64 {
+	return perHour(float64(s.StartLevel-s.EndLevel), s.Duration())
+}
+
+// RangePerHour returns the range lost per hour over the whole session
+func (s *DrainSession) RangePerHour() float64 {
+	return perHour(s.StartRange-s.EndRange, s.Duration())
+}
+
+// DrainOptions configures a drain analyzer. Options that are not set use their defaults.
+type DrainOptions struct {
+	// MaxLevelPerHour is the battery level that may be lost per hour while
+	// asleep or awake, not counting sentry mode and climate control; defaults to 0.2
+	MaxLevelPerHour float64
+	// MaxAwake is the fraction of a session the vehicle may spend awake without
+	// sentry mode or climate control; defaults to 0.5
+	MaxAwake float64
+	// MaxSentryLevelPerHour is the battery level that may be lost per hour with
+	// sentry mode on; defaults to 1.5
+	MaxSentryLevelPerHour float64
+	// MaxClimateLevelPerHour is the battery level that may be lost per hour with
+	// climate control on; defaults to 8
+	MaxClimateLevelPerHour float64
+	// MinDuration is how long a session must be to be judged abnormal; defaults to 1 hour
+	MinDuration time.Duration
+}
+
+var (
+	defaultMaxLevelPerHour  = 0.2
+	defaultMaxAwake         = 0.5
+	defaultMaxSentryDrain   = 1.5
+	defaultMaxClimateDrain  = 8.0
+	defaultMinDrainDuration = time.Hour
+)
+
+// DrainAnalyzer measures the charge a vehicle loses while parked and attributes
+// it to what the vehicle was doing. The battery level is only known while the
+// vehicle is online, so the loss between two readings is split between the
+// conditions in effect meanwhile in proportion to the time spent in each.
+type DrainAnalyzer struct {
+	opts      DrainOptions
+	current   *DrainSession
+	last      time.Time
+	condition DrainCondition
+	sentry    bool
+	climate   bool
+	pending   map[DrainCondition]time.Duration
+}
+
+// NewDrainAnalyzer creates an analyzer with no session in progress
+func NewDrainAnalyzer(opts *DrainOptions) *DrainAnalyzer {
+	a := &DrainAnalyzer{}
+	if opts != nil {
+		a.opts = *opts
+	}
+	if a.opts.MaxLevelPerHour <= 0 {
+		a.opts.MaxLevelPerHour = defaultMaxLevelPerHour
+	}
+	if a.opts.MaxAwake <= 0 {
+		a.opts.MaxAwake = defaultMaxAwake
+	}
+	if a.opts.MaxSentryLevelPerHour <= 0 {
+		a.opts.MaxSentryLevelPerHour = defaultMaxSentryDrain
+	}
+	if a.opts.MaxClimateLevelPerHour <= 0 {
+		a.opts.MaxClimateLevelPerHour = defaultMaxClimateDrain
+	}
+	if a.opts.MinDuration <= 0 {
+		a.opts.MinDuration = defaultMinDrainDuration
+	}
+	return a
+}
+
+// DetectDrainSessions reads snapshots until the channel is closed and sends each
+// parked session analyzed
+func DetectDrainSessions(snapshots <-chan *WatchSnapshot, opts *DrainOptions) <-chan *DrainSession {
+	sessions := make(chan *DrainSession)
+	go func() {
+		defer close(sessions)
+		a := NewDrainAnalyzer(opts)
+		for snapshot := range snapshots {
+			state := &StateSnapshot{
+				ChargeState:  snapshot.ChargeState,
+				ClimateState: snapshot.ClimateState,
+				DriveState:   snapshot.DriveState,
+				VehicleState: snapshot.VehicleState,
+			}
+			if session := a.Add(snapshot.Time, snapshot.State, state); session != nil {
+				sessions <- session
+			}
+		}
+		if session := a.Flush(); session != nil {
+			sessions <- session
+		}
+	}()
+	return sessions
+}
+
+// Current returns the session in progress, if any
+func (a *DrainAnalyzer) Current() *DrainSession {
+	return a.current
+}
+
+// Add processes a poll of the vehicle at the given time: its state, such as
+// "online" or "asleep", and whichever of its states were read, if any. It
+// returns the session the poll ends, if any.
+func (a *DrainAnalyzer) Add(t time.Time, state string, snapshot *StateSnapshot) *DrainSession {
+	if snapshot == nil {
+		snapshot = &StateSnapshot{}
+	}
+	if isActive(snapshot.ChargeState, snapshot.DriveState) {
+		return a.Flush()
+	}
+
+	// the time since the previous poll is spent in the condition it observed
+	if a.current != nil {
+		a.pending[a.condition] += t.Sub(a.last)
+	}
+	a.last = t
+	if state != "online" {
+		a.sentry, a.climate = false, false
+	}
+	if snapshot.VehicleState != nil {
+		a.sentry = snapshot.VehicleState.SentryMode
+	}
+	if snapshot.ClimateState != nil {
+		a.climate = snapshot.ClimateState.IsClimateOn
+	}
+	switch {
+	case state != "online":
+		a.condition = DrainAsleep
+	case a.climate:
+		a.condition = DrainClimate
+	case a.sentry:
+		a.condition = DrainSentry
+	default:
+		a.condition = DrainAwake
+	}
+
+	charge := snapshot.ChargeState
+	if charge == nil {
+		return nil
+	}
+	if a.current == nil {
+		a.current = &DrainSession{
+			Start:      t,
+			StartLevel: charge.BatteryLevel,
+			StartRange: charge.BatteryRange,
+			Periods:    map[DrainCondition]*DrainPeriod{},
+		}
+		a.current.End, a.current.EndLevel, a.current.EndRange = t, charge.BatteryLevel, charge.BatteryRange
+		a.pending = map[DrainCondition]time.Duration{}
+	}
+	if a.current.Location == nil && snapshot.DriveState != nil {
+		a.current.Location = driveLocation(snapshot.DriveState)
+	}
+	a.reading(t, charge)
+	return nil
+}
+
+// Flush ends the session in progress and returns it, unless it has only one reading
+func (a *DrainAnalyzer) Flush() *DrainSession {
+	session := a.current
+	a.current = nil
+	a.pending = nil
+	if session == nil || session.Duration() <= 0 {
+		return nil
+	}
+
+	if session.Duration() >= a.opts.MinDuration {
+		var idle DrainPeriod
+		for _, condition := range []DrainCondition{DrainAsleep, DrainAwake} {
+			if p, ok := session.Periods[condition]; ok {
+				idle.Duration += p.Duration
+				idle.LevelLost += p.LevelLost
+				idle.RangeLost += p.RangeLost
+			}
+		}
+		if idle.Duration > 0 && idle.LevelPerHour() > a.opts.MaxLevelPerHour {
+			session.Reasons = append(session.Reasons, "high drain")
+		}
+		if p, ok := session.Periods[DrainAwake]; ok && p.Duration.Hours()/session.Duration().Hours() > a.opts.MaxAwake {
+			session.Reasons = append(session.Reasons, "kept awake")
+		}
+		if p, ok := session.Periods[DrainSentry]; ok && p.LevelPerHour() > a.opts.MaxSentryLevelPerHour {
+			session.Reasons = append(session.Reasons, "high sentry drain")
+		}
+		if p, ok := session.Periods[DrainClimate]; ok && p.LevelPerHour() > a.opts.MaxClimateLevelPerHour {
+			session.Reasons = append(session.Reasons, "high climate drain")
+		}
+		session.Abnormal = len(session.Reasons) > 0
+	}
+	return session
+}
+
+// reading splits the charge lost since the previous reading between the
+// conditions in effect meanwhile
+func (a *DrainAnalyzer) reading(t time.Time, charge *ChargeState) {
+	session := a.current
+	var total time.Duration
+	for _, d := range a.pending {
+		total += d
+	}
+	levelLost := float64(session.EndLevel - charge.BatteryLevel)
+	rangeLost := session.EndRange - charge.BatteryRange
+	for condition, d := range a.pending {
+		if total <= 0 {
+			break
+		}
+		p, ok := session.Periods[condition]
+		if !ok {
+			p = &DrainPeriod{}
+			session.Periods[condition] = p
+		}
+		share := float64(d) / float64(total)
+		p.Duration += d
+		p.LevelLost += levelLost * share
+		p.RangeLost += rangeLost * share
+	}
+	a.pending = map[DrainCondition]time.Duration{}
+	session.End, session.EndLevel, session.EndRange = t, charge.BatteryLevel, charge.BatteryRange
+}
+
+// perHour divides an amount by a duration in hours, or returns 0 for no duration
+func perHour(amount float64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return amount / d.Hours()
+}
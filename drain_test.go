@@ -0,0 +1,123 @@
+package tesla
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDrainAnalyzer(t *testing.T) {
+	start := time.Unix(1460905367, 0)
+	at := func(hours int) time.Time { return start.Add(time.Duration(hours) * time.Hour) }
+	parked := &DriveState{Latitude: 30, Longitude: -100}
+	online := func(level int, batteryRange float64, sentry bool) *StateSnapshot {
+		return &StateSnapshot{
+			ChargeState:  &ChargeState{ChargingState: "Disconnected", BatteryLevel: level, BatteryRange: batteryRange},
+			ClimateState: &ClimateState{},
+			DriveState:   parked,
+			VehicleState: &VehicleState{SentryMode: sentry},
+		}
+	}
+
+	a := NewDrainAnalyzer(nil)
+	assert.Nil(t, a.Add(at(0), "online", online(80, 240, false)))
+	assert.Nil(t, a.Add(at(1), "online", online(80, 239.5, false)))
+	assert.Nil(t, a.Add(at(2), "asleep", nil))
+	assert.Nil(t, a.Add(at(5), "asleep", nil))
+	// the loss since the last reading is split between an hour awake and four asleep
+	assert.Nil(t, a.Add(at(6), "online", online(79, 237.5, true)))
+	assert.Nil(t, a.Add(at(8), "online", online(76, 230, true)))
+	assert.NotNil(t, a.Current())
+
+	charging := &StateSnapshot{ChargeState: &ChargeState{ChargingState: "Charging", BatteryLevel: 76}}
+	session := a.Add(at(9), "online", charging)
+	assert.Nil(t, a.Current())
+	if !assert.NotNil(t, session) {
+		return
+	}
+	assert.Equal(t, at(0), session.Start)
+	assert.Equal(t, 8*time.Hour, session.Duration())
+	assert.Equal(t, &Location{Latitude: 30, Longitude: -100}, session.Location)
+	assert.InDelta(t, 0.5, session.LevelPerHour(), 1e-9)
+	assert.InDelta(t, 1.25, session.RangePerHour(), 1e-9)
+	assert.Len(t, session.Periods, 3)
+	awake := session.Periods[DrainAwake]
+	assert.Equal(t, 2*time.Hour, awake.Duration)
+	assert.InDelta(t, 0.2, awake.LevelLost, 1e-9)
+	assert.InDelta(t, 0.9, awake.RangeLost, 1e-9)
+	asleep := session.Periods[DrainAsleep]
+	assert.Equal(t, 4*time.Hour, asleep.Duration)
+	assert.InDelta(t, 0.8, asleep.LevelLost, 1e-9)
+	assert.InDelta(t, 0.4, asleep.RangePerHour(), 1e-9)
+	sentry := session.Periods[DrainSentry]
+	assert.Equal(t, 2*time.Hour, sentry.Duration)
+	assert.InDelta(t, 1.5, sentry.LevelPerHour(), 1e-9)
+	// sentry mode accounts for most of the loss, which is expected
+	assert.False(t, session.Abnormal)
+	assert.Empty(t, session.Reasons)
+
+	// kept awake without sentry mode or climate control and losing 2% an hour
+	assert.Nil(t, a.Add(at(10), "online", &StateSnapshot{ChargeState: &ChargeState{ChargingState: "Complete", BatteryLevel: 80}, VehicleState: &VehicleState{}}))
+	for hour := 11; hour <= 16; hour++ {
+		assert.Nil(t, a.Add(at(hour), "online", online(80-2*(hour-10), 0, false)))
+	}
+	session = a.Flush()
+	assert.Equal(t, 6*time.Hour, session.Duration())
+	assert.Equal(t, &Location{Latitude: 30, Longitude: -100}, session.Location)
+	assert.True(t, session.Abnormal)
+	assert.Equal(t, []string{"high drain", "kept awake"}, session.Reasons)
+
+	// sentry mode is expected to drain the battery, but not by 3% an hour
+	a.Flush()
+	for hour := 17; hour <= 19; hour++ {
+		assert.Nil(t, a.Add(at(hour), "online", online(80-3*(hour-17), 0, true)))
+	}
+	session = a.Flush()
+	assert.True(t, session.Abnormal)
+	assert.Equal(t, []string{"high sentry drain"}, session.Reasons)
+
+	// a single reading is not a session
+	a.Add(at(20), "online", online(70, 200, false))
+	assert.Nil(t, a.Flush())
+}
+
+func TestDetectDrainSessions(t *testing.T) {
+	start := time.Unix(1460905367, 0)
+	snapshots := make(chan *WatchSnapshot)
+	sessions := DetectDrainSessions(snapshots, nil)
+	go func() {
+		snapshots <- &WatchSnapshot{Time: start, State: "online", ChargeState: &ChargeState{BatteryLevel: 60, BatteryRange: 180}}
+		snapshots <- &WatchSnapshot{Time: start.Add(time.Hour), State: "asleep"}
+		snapshots <- &WatchSnapshot{Time: start.Add(5 * time.Hour), State: "online", ChargeState: &ChargeState{BatteryLevel: 59, BatteryRange: 178}}
+		snapshots <- &WatchSnapshot{Time: start.Add(6 * time.Hour), State: "online", ChargeState: &ChargeState{ChargingState: "Charging", BatteryLevel: 59}}
+		// awake all along with sentry mode on, which is not being kept awake
+		for hour := 7; hour <= 10; hour++ {
+			snapshots <- &WatchSnapshot{
+				Time:         start.Add(time.Duration(hour) * time.Hour),
+				State:        "online",
+				ChargeState:  &ChargeState{ChargingState: "Complete", BatteryLevel: 97 - hour, BatteryRange: 270},
+				ClimateState: &ClimateState{},
+				VehicleState: &VehicleState{SentryMode: true},
+			}
+		}
+		close(snapshots)
+	}()
+
+	var detected []*DrainSession
+	for session := range sessions {
+		detected = append(detected, session)
+	}
+	if !assert.Len(t, detected, 2) {
+		return
+	}
+	assert.Equal(t, time.Hour, detected[0].Periods[DrainAwake].Duration)
+	assert.Equal(t, 4*time.Hour, detected[0].Periods[DrainAsleep].Duration)
+	assert.InDelta(t, 1.6, detected[0].Periods[DrainAsleep].RangeLost, 1e-9)
+	assert.False(t, detected[0].Abnormal)
+
+	assert.Len(t, detected[1].Periods, 1)
+	assert.Equal(t, 3*time.Hour, detected[1].Periods[DrainSentry].Duration)
+	assert.InDelta(t, 3, detected[1].Periods[DrainSentry].LevelLost, 1e-9)
+	assert.False(t, detected[1].Abnormal)
+}
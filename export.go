@@ -0,0 +1,237 @@
+package tesla
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// gpxNamespace is the namespace of GPX 1.1 documents, and gpxExtensionNamespace
+// that of the extensions written with the tesla prefix
+const (
+	gpxNamespace          = "http://www.topografix.com/GPX/1/1"
+	gpxExtensionNamespace = "https://github.com/billcobbler/tesla"
+)
+
+// gpx is the root of a GPX 1.1 document. XMLNSExt declares the tesla prefix
+// used by the extension elements, and must be set to gpxExtensionNamespace.
+type gpx struct {
+	XMLName  xml.Name `xml:"gpx"`
+	Version  string   `xml:"version,attr"`
+	Creator  string   `xml:"creator,attr"`
+	XMLNS    string   `xml:"xmlns,attr"`
+	XMLNSExt string   `xml:"xmlns:tesla,attr"`
+	Track    gpxTrack `xml:"trk"`
+}
+
+type gpxTrack struct {
+	Name    string        `xml:"name,omitempty"`
+	Segment gpxTrkSegment `xml:"trkseg"`
+}
+
+type gpxTrkSegment struct {
+	Points []gpxPoint `xml:"trkpt"`
+}
+
+// gpxPoint is a track point; speed is in miles per hour and power in kW
+type gpxPoint struct {
+	Lat        float64        `xml:"lat,attr"`
+	Lon        float64        `xml:"lon,attr"`
+	Ele        *int           `xml:"ele,omitempty"`
+	Time       string         `xml:"time"`
+	Extensions *gpxExtensions `xml:"extensions,omitempty"`
+}
+
+type gpxExtensions struct {
+	Speed *int `xml:"tesla:speed,omitempty"`
+	Power *int `xml:"tesla:power,omitempty"`
+	Soc   *int `xml:"tesla:soc,omitempty"`
+}
+
+// kml is the root of a KML 2.2 document with a single line string placemark
+type kml struct {
+	XMLName   xml.Name     `xml:"kml"`
+	XMLNS     string       `xml:"xmlns,attr"`
+	Placemark kmlPlacemark `xml:"Document>Placemark"`
+}
+
+type kmlPlacemark struct {
+	Name       string        `xml:"name,omitempty"`
+	TimeSpan   *kmlTimeSpan  `xml:"TimeSpan,omitempty"`
+	LineString kmlLineString `xml:"LineString"`
+}
+
+type kmlTimeSpan struct {
+	Begin string `xml:"begin"`
+	End   string `xml:"end"`
+}
+
+type kmlLineString struct {
+	Tessellate   int    `xml:"tessellate"`
+	AltitudeMode string `xml:"altitudeMode"`
+	Coordinates  string `xml:"coordinates"`
+}
+
+// geoJSONFeatureCollection is a GeoJSON document holding the track as a LineString
+type geoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []geoJSONFeature `json:"features"`
+}
+
+type geoJSONFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   geoJSONGeometry        `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type geoJSONGeometry struct {
+	Type        string      `json:"type"`
+	Coordinates [][]float64 `json:"coordinates"`
+}
+
+// WriteGPX writes the located events as a GPX track. Speed, power and state of
+// charge are written as tesla:speed, tesla:power and tesla:soc extensions, in
+// the https://github.com/billcobbler/tesla namespace declared on the root.
+func WriteGPX(w io.Writer, name string, events []*StreamEvent) error {
+	doc := &gpx{
+		Version:  "1.1",
+		Creator:  "github.com/billcobbler/tesla",
+		XMLNS:    gpxNamespace,
+		XMLNSExt: gpxExtensionNamespace,
+		Track:    gpxTrack{Name: name},
+	}
+	for _, event := range located(events) {
+		point := gpxPoint{
+			Lat:  *event.EstLat,
+			Lon:  *event.EstLng,
+			Ele:  event.Elevation,
+			Time: event.Timestamp.UTC().Format(time.RFC3339),
+		}
+		if event.Speed != nil || event.Power != nil || event.Soc != nil {
+			point.Extensions = &gpxExtensions{Speed: event.Speed, Power: event.Power, Soc: event.Soc}
+		}
+		doc.Track.Segment.Points = append(doc.Track.Segment.Points, point)
+	}
+	return writeXML(w, doc)
+}
+
+// WriteKML writes the located events as a KML line string
+func WriteKML(w io.Writer, name string, events []*StreamEvent) error {
+	points := located(events)
+	coordinates := make([]string, 0, len(points))
+	altitudeMode := "absolute"
+	for _, event := range points {
+		coordinate := strconv.FormatFloat(*event.EstLng, 'f', -1, 64) + "," + strconv.FormatFloat(*event.EstLat, 'f', -1, 64)
+		if event.Elevation != nil {
+			coordinate += "," + strconv.Itoa(*event.Elevation)
+		} else {
+			altitudeMode = "clampToGround"
+		}
+		coordinates = append(coordinates, coordinate)
+	}
+
+	doc := &kml{
+		XMLNS: "http://www.opengis.net/kml/2.2",
+		Placemark: kmlPlacemark{
+			Name: name,
+			LineString: kmlLineString{
+				Tessellate:   1,
+				AltitudeMode: altitudeMode,
+				Coordinates:  strings.Join(coordinates, " "),
+			},
+		},
+	}
+	if len(points) > 0 {
+		doc.Placemark.TimeSpan = &kmlTimeSpan{
+			Begin: points[0].Timestamp.UTC().Format(time.RFC3339),
+			End:   points[len(points)-1].Timestamp.UTC().Format(time.RFC3339),
+		}
+	}
+	return writeXML(w, doc)
+}
+
+// WriteGeoJSON writes the located events as a GeoJSON feature collection holding
+// a LineString feature. The times, speeds, power and state of charge of each
+// point are listed in the feature's properties.
+func WriteGeoJSON(w io.Writer, name string, events []*StreamEvent) error {
+	points := located(events)
+	coordinates := make([][]float64, 0, len(points))
+	times := make([]string, 0, len(points))
+	speeds := make([]*int, 0, len(points))
+	power := make([]*int, 0, len(points))
+	soc := make([]*int, 0, len(points))
+	for _, event := range points {
+		coordinate := []float64{*event.EstLng, *event.EstLat}
+		if event.Elevation != nil {
+			coordinate = append(coordinate, float64(*event.Elevation))
+		}
+		coordinates = append(coordinates, coordinate)
+		times = append(times, event.Timestamp.UTC().Format(time.RFC3339))
+		speeds = append(speeds, event.Speed)
+		power = append(power, event.Power)
+		soc = append(soc, event.Soc)
+	}
+
+	doc := &geoJSONFeatureCollection{
+		Type: "FeatureCollection",
+		Features: []geoJSONFeature{{
+			Type:     "Feature",
+			Geometry: geoJSONGeometry{Type: "LineString", Coordinates: coordinates},
+			Properties: map[string]interface{}{
+				"name":       name,
+				"coordTimes": times,
+				"speed":      speeds,
+				"power":      power,
+				"soc":        soc,
+			},
+		}},
+	}
+	return json.NewEncoder(w).Encode(doc)
+}
+
+// WriteGPX writes the trip as a GPX track
+func (t *Trip) WriteGPX(w io.Writer) error {
+	return WriteGPX(w, t.name(), t.Events)
+}
+
+// WriteKML writes the trip as a KML line string
+func (t *Trip) WriteKML(w io.Writer) error {
+	return WriteKML(w, t.name(), t.Events)
+}
+
+// WriteGeoJSON writes the trip as a GeoJSON feature collection
+func (t *Trip) WriteGeoJSON(w io.Writer) error {
+	return WriteGeoJSON(w, t.name(), t.Events)
+}
+
+// name describes the trip by its start time
+func (t *Trip) name() string {
+	return "Trip " + t.Start.Format(time.RFC3339)
+}
+
+// located returns the events that have a location
+func located(events []*StreamEvent) []*StreamEvent {
+	points := make([]*StreamEvent, 0, len(events))
+	for _, event := range events {
+		if event.EstLat != nil && event.EstLng != nil {
+			points = append(points, event)
+		}
+	}
+	return points
+}
+
+func writeXML(w io.Writer, doc interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
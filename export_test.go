@@ -0,0 +1,70 @@
+package tesla
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExport(t *testing.T) {
+	events := tripEvents(t)
+	// events without a location are skipped
+	unlocated, _ := parseStreamEvent("1460905361000,0,P", []string{"speed", "shift_state"})
+	events = append(events[:2], append([]*StreamEvent{unlocated}, events[2:4]...)...)
+	trip := &Trip{Events: events}
+
+	var buffer bytes.Buffer
+	assert.Nil(t, WriteGPX(&buffer, "Commute", events))
+	assert.True(t, strings.HasPrefix(buffer.String(), xml.Header))
+	doc := &gpx{}
+	assert.Nil(t, xml.Unmarshal(buffer.Bytes(), doc))
+	assert.Equal(t, "Commute", doc.Track.Name)
+	points := doc.Track.Segment.Points
+	assert.Len(t, points, 4)
+	assert.Equal(t, 30.007, points[2].Lat)
+	assert.Equal(t, -100.0, points[2].Lon)
+	assert.Equal(t, 110, *points[2].Ele)
+	assert.Equal(t, "2016-04-17T15:03:40Z", points[2].Time)
+	assert.Contains(t, buffer.String(), "<tesla:speed>30</tesla:speed>")
+	assert.Contains(t, buffer.String(), "<tesla:power>20</tesla:power>")
+	assert.Contains(t, buffer.String(), "<tesla:soc>80</tesla:soc>")
+	// the tesla prefix is bound to the extension namespace
+	decoder := xml.NewDecoder(bytes.NewReader(buffer.Bytes()))
+	var spaces []string
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		if start, ok := token.(xml.StartElement); ok && start.Name.Local == "speed" {
+			spaces = append(spaces, start.Name.Space)
+		}
+	}
+	assert.Len(t, spaces, 4)
+	for _, space := range spaces {
+		assert.Equal(t, gpxExtensionNamespace, space)
+	}
+
+	buffer.Reset()
+	assert.Nil(t, trip.WriteKML(&buffer))
+	assert.Contains(t, buffer.String(), "<name>Trip 0001-01-01T00:00:00Z</name>")
+	assert.Contains(t, buffer.String(), "<altitudeMode>absolute</altitudeMode>")
+	assert.Contains(t, buffer.String(), "<coordinates>-100,30,100 -100,30,100 -100,30.007,110 -100,30.021,105</coordinates>")
+	assert.Contains(t, buffer.String(), "<begin>2016-04-17T15:01:40Z</begin>")
+	assert.Contains(t, buffer.String(), "<end>2016-04-17T15:04:40Z</end>")
+
+	buffer.Reset()
+	assert.Nil(t, trip.WriteGeoJSON(&buffer))
+	collection := &geoJSONFeatureCollection{}
+	assert.Nil(t, json.Unmarshal(buffer.Bytes(), collection))
+	assert.Equal(t, "FeatureCollection", collection.Type)
+	feature := collection.Features[0]
+	assert.Equal(t, "LineString", feature.Geometry.Type)
+	assert.Equal(t, []float64{-100, 30.021, 105}, feature.Geometry.Coordinates[3])
+	assert.Equal(t, []interface{}{0.0, 0.0, 30.0, 60.0}, feature.Properties["speed"])
+	assert.Len(t, feature.Properties["coordTimes"], 4)
+}
@@ -0,0 +1,217 @@
+package tesla
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Geofence is a named area, either a circle around Center or a polygon. Polygon
+// vertices are joined in order and the last vertex is joined back to the first.
+type Geofence struct {
+	Name         string     `json:"name"`
+	Center       *Location  `json:"center,omitempty"`
+	RadiusMeters float64    `json:"radius_meters,omitempty"`
+	Polygon      []Location `json:"polygon,omitempty"`
+}
+
+// Contains reports whether the location is inside the fence
+func (g *Geofence) Contains(location Location) bool {
+	return g.distance(location) <= 0
+}
+
+// check validates that the fence is either a circle or a polygon
+func (g *Geofence) check() error {
+	switch {
+	case g.Center != nil && len(g.Polygon) > 0:
+		return fmt.Errorf("geofence %q has both a center and a polygon", g.Name)
+	case g.Center != nil:
+		if g.RadiusMeters <= 0 {
+			return fmt.Errorf("geofence %q has no radius", g.Name)
+		}
+	case len(g.Polygon) < 3:
+		return fmt.Errorf("geofence %q needs a center or a polygon of at least 3 points", g.Name)
+	}
+	return nil
+}
+
+// distance returns how far the location is outside the fence's edge in meters;
+// it is negative when the location is inside
+func (g *Geofence) distance(location Location) float64 {
+	if g.Center != nil {
+		return distanceMeters(g.Center.Latitude, g.Center.Longitude, location.Latitude, location.Longitude) - g.RadiusMeters
+	}
+
+	// project the vertices onto a plane in meters centered on the location, which
+	// is accurate enough for fences a few kilometers across
+	const metersPerDegree = 6371000.0 * math.Pi / 180
+	scale := math.Cos(location.Latitude * math.Pi / 180)
+	xs := make([]float64, len(g.Polygon))
+	ys := make([]float64, len(g.Polygon))
+	for i, vertex := range g.Polygon {
+		xs[i] = (vertex.Longitude - location.Longitude) * scale * metersPerDegree
+		ys[i] = (vertex.Latitude - location.Latitude) * metersPerDegree
+	}
+
+	inside := false
+	nearest := math.Inf(1)
+	for i, j := 0, len(xs)-1; i < len(xs); j, i = i, i+1 {
+		if (ys[i] > 0) != (ys[j] > 0) && 0 < (xs[j]-xs[i])*(0-ys[i])/(ys[j]-ys[i])+xs[i] {
+			inside = !inside
+		}
+		nearest = math.Min(nearest, distanceToSegment(xs[i], ys[i], xs[j], ys[j]))
+	}
+	if inside {
+		return -nearest
+	}
+	return nearest
+}
+
+// distanceToSegment returns the distance from the origin to the segment between two points
+func distanceToSegment(x1, y1, x2, y2 float64) float64 {
+	dx, dy := x2-x1, y2-y1
+	t := 0.0
+	if length := dx*dx + dy*dy; length > 0 {
+		t = math.Max(0, math.Min(1, -(x1*dx+y1*dy)/length))
+	}
+	return math.Hypot(x1+t*dx, y1+t*dy)
+}
+
+// GeofenceEventType is the kind of a geofence event
+type GeofenceEventType int
+
+const (
+	// GeofenceEnter is reported when the vehicle moves into a fence
+	GeofenceEnter GeofenceEventType = iota
+	// GeofenceExit is reported when the vehicle leaves a fence by more than the hysteresis
+	GeofenceExit
+	// GeofenceDwell is reported once the vehicle has stayed inside a fence for the dwell time
+	GeofenceDwell
+)
+
+func (t GeofenceEventType) String() string {
+	switch t {
+	case GeofenceEnter:
+		return "enter"
+	case GeofenceExit:
+		return "exit"
+	case GeofenceDwell:
+		return "dwell"
+	}
+	return "unknown"
+}
+
+// GeofenceEvent reports a vehicle entering, leaving or dwelling in a fence
+type GeofenceEvent struct {
+	Type     GeofenceEventType
+	Fence    string
+	Location Location
+	Time     time.Time
+}
+
+// GeofenceOptions configures a geofence monitor
+type GeofenceOptions struct {
+	// Hysteresis is how far in meters the vehicle must move outside a fence
+	// before it is considered to have left; defaults to 25 meters
+	Hysteresis float64
+	// DwellTime is how long the vehicle must stay inside a fence before a dwell
+	// event is reported; no dwell events are reported when zero
+	DwellTime time.Duration
+}
+
+var defaultGeofenceHysteresis = 25.0
+
+// GeofenceMonitor follows the location of a single vehicle and reports when it
+// enters, leaves or dwells in its fences. The first location only establishes
+// which fences the vehicle is in, without reporting events. Dwell events are
+// detected when a location is received, so they are delayed until the next one.
+type GeofenceMonitor struct {
+	fences []*Geofence
+	opts   GeofenceOptions
+	states map[string]*fenceState
+}
+
+type fenceState struct {
+	inside  bool
+	since   time.Time
+	dwelled bool
+}
+
+// NewGeofenceMonitor creates a monitor for the given fences, which must have unique names
+func NewGeofenceMonitor(fences []*Geofence, opts *GeofenceOptions) (*GeofenceMonitor, error) {
+	m := &GeofenceMonitor{fences: fences}
+	if opts != nil {
+		m.opts = *opts
+	}
+	if m.opts.Hysteresis <= 0 {
+		m.opts.Hysteresis = defaultGeofenceHysteresis
+	}
+	names := map[string]bool{}
+	for _, fence := range fences {
+		if err := fence.check(); err != nil {
+			return nil, err
+		}
+		if names[fence.Name] {
+			return nil, fmt.Errorf("duplicate geofence %q", fence.Name)
+		}
+		names[fence.Name] = true
+	}
+	return m, nil
+}
+
+// Inside reports whether the vehicle was last seen inside the named fence
+func (m *GeofenceMonitor) Inside(name string) bool {
+	state, ok := m.states[name]
+	return ok && state.inside
+}
+
+// Update processes a location received at the given time
+func (m *GeofenceMonitor) Update(location Location, t time.Time) []*GeofenceEvent {
+	if m.states == nil {
+		m.states = map[string]*fenceState{}
+	}
+
+	var events []*GeofenceEvent
+	for _, fence := range m.fences {
+		distance := fence.distance(location)
+		state, ok := m.states[fence.Name]
+		if !ok {
+			m.states[fence.Name] = &fenceState{inside: distance <= 0, since: t}
+			continue
+		}
+
+		switch {
+		case !state.inside && distance <= 0:
+			*state = fenceState{inside: true, since: t}
+			events = append(events, &GeofenceEvent{Type: GeofenceEnter, Fence: fence.Name, Location: location, Time: t})
+		case state.inside && distance > m.opts.Hysteresis:
+			*state = fenceState{inside: false, since: t}
+			events = append(events, &GeofenceEvent{Type: GeofenceExit, Fence: fence.Name, Location: location, Time: t})
+		case state.inside && !state.dwelled && m.opts.DwellTime > 0 && t.Sub(state.since) >= m.opts.DwellTime:
+			state.dwelled = true
+			events = append(events, &GeofenceEvent{Type: GeofenceDwell, Fence: fence.Name, Location: location, Time: t})
+		}
+	}
+	return events
+}
+
+// UpdateDriveState processes the location of a polled drive state, timed by its GPS fix
+func (m *GeofenceMonitor) UpdateDriveState(state *DriveState) []*GeofenceEvent {
+	location := driveLocation(state)
+	if location == nil {
+		return nil
+	}
+	t := time.Now()
+	if state.GpsAsOf > 0 {
+		t = time.Unix(state.GpsAsOf, 0)
+	}
+	return m.Update(*location, t)
+}
+
+// UpdateStreamEvent processes the estimated location of a stream event
+func (m *GeofenceMonitor) UpdateStreamEvent(event *StreamEvent) []*GeofenceEvent {
+	if event.EstLat == nil || event.EstLng == nil {
+		return nil
+	}
+	return m.Update(Location{Latitude: *event.EstLat, Longitude: *event.EstLng}, event.Timestamp)
+}
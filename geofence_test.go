@@ -0,0 +1,73 @@
+package tesla
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeofence(t *testing.T) {
+	home := &Geofence{Name: "home", Center: &Location{Latitude: 30, Longitude: -100}, RadiusMeters: 100}
+	depot := &Geofence{Name: "depot", Polygon: []Location{
+		{Latitude: 30.01, Longitude: -100.01},
+		{Latitude: 30.01, Longitude: -100},
+		{Latitude: 30.02, Longitude: -100},
+		{Latitude: 30.02, Longitude: -100.01},
+	}}
+	assert.True(t, home.Contains(Location{Latitude: 30.0005, Longitude: -100}))
+	assert.False(t, home.Contains(Location{Latitude: 30.001, Longitude: -100}))
+	assert.True(t, depot.Contains(Location{Latitude: 30.015, Longitude: -100.005}))
+	assert.False(t, depot.Contains(Location{Latitude: 30.015, Longitude: -99.999}))
+	assert.InDelta(t, 96, depot.distance(Location{Latitude: 30.015, Longitude: -99.999}), 1)
+
+	_, err := NewGeofenceMonitor([]*Geofence{{Name: "nowhere"}}, nil)
+	assert.NotNil(t, err)
+	_, err = NewGeofenceMonitor([]*Geofence{home, home}, nil)
+	assert.NotNil(t, err)
+
+	monitor, err := NewGeofenceMonitor([]*Geofence{home, depot}, &GeofenceOptions{Hysteresis: 50, DwellTime: 10 * time.Minute})
+	assert.Nil(t, err)
+	start := time.Unix(1460905367, 0)
+	at := func(minutes int, latitude float64) []*GeofenceEvent {
+		return monitor.Update(Location{Latitude: latitude, Longitude: -100}, start.Add(time.Duration(minutes)*time.Minute))
+	}
+
+	// the first location only establishes where the vehicle is
+	assert.Empty(t, at(0, 30))
+	assert.True(t, monitor.Inside("home"))
+	assert.False(t, monitor.Inside("depot"))
+
+	// wandering just outside the edge is within the hysteresis
+	assert.Empty(t, at(1, 30.0012))
+	assert.True(t, monitor.Inside("home"))
+
+	events := at(10, 30)
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, GeofenceDwell, events[0].Type)
+		assert.Equal(t, "home", events[0].Fence)
+	}
+	assert.Empty(t, at(11, 30))
+
+	events = at(12, 30.002)
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, GeofenceExit, events[0].Type)
+		assert.Equal(t, "exit", events[0].Type.String())
+	}
+	assert.Empty(t, at(13, 30.0012))
+
+	latitude, longitude := 30.015, -100.005
+	events = monitor.UpdateStreamEvent(&StreamEvent{EstLat: &latitude, EstLng: &longitude, Timestamp: start.Add(20 * time.Minute)})
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, GeofenceEnter, events[0].Type)
+		assert.Equal(t, "depot", events[0].Fence)
+		assert.Equal(t, start.Add(20*time.Minute), events[0].Time)
+	}
+
+	events = monitor.UpdateDriveState(&DriveState{Latitude: 30.0001, Longitude: -100, GpsAsOf: start.Add(30 * time.Minute).Unix()})
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, &GeofenceEvent{Type: GeofenceEnter, Fence: "home", Location: Location{Latitude: 30.0001, Longitude: -100}, Time: start.Add(30 * time.Minute)}, events[0])
+		assert.Equal(t, GeofenceExit, events[1].Type)
+		assert.Equal(t, "depot", events[1].Fence)
+	}
+}
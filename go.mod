@@ -2,4 +2,8 @@ module github.com/billcobbler/tesla
 
 go 1.14
 
-require github.com/stretchr/testify v1.6.1
+require (
+	github.com/gorilla/websocket v1.4.2
+	github.com/stretchr/testify v1.6.1
+	gopkg.in/yaml.v3 v3.0.1
+)
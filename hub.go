@@ -0,0 +1,224 @@
+package tesla
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// BackpressurePolicy decides what happens when a subscriber's buffer is full
+type BackpressurePolicy int
+
+const (
+	// DropOldest discards the oldest buffered event to make room for the new one
+	DropOldest BackpressurePolicy = iota
+	// DropNewest discards the new event
+	DropNewest
+	// Block waits for the subscriber to read, stalling every subscriber of the vehicle
+	Block
+)
+
+// SubscribeOptions configures a subscription to a stream hub
+type SubscribeOptions struct {
+	// Buffer is the number of events held for the subscriber; defaults to 64
+	Buffer int
+	// Policy is applied when the buffer is full; defaults to DropOldest
+	Policy BackpressurePolicy
+}
+
+// ErrHubClosed is returned when subscribing to a closed stream hub
+var ErrHubClosed = errors.New("stream hub closed")
+
+var defaultSubscribeBuffer = 64
+
+// StreamHub shares one managed stream per vehicle between many subscribers. The
+// stream is started by the first subscriber and closed when the last one leaves.
+type StreamHub struct {
+	opts      *StreamOptions
+	mu        sync.Mutex
+	upstreams map[int64]*hubUpstream
+	closed    bool
+}
+
+// hubUpstream is the managed stream of a single vehicle and its subscribers
+type hubUpstream struct {
+	stream      *ManagedStream
+	subscribers map[*Subscription]struct{}
+}
+
+// Subscription receives the events of a vehicle from a stream hub. Events is
+// closed once the subscription or the hub is closed.
+type Subscription struct {
+	Events <-chan *StreamEvent
+
+	events    chan *StreamEvent
+	policy    BackpressurePolicy
+	hub       *StreamHub
+	vehicleID int64
+	dropped   int64
+	done      chan struct{}
+	closeOnce sync.Once
+	mu        sync.Mutex
+	closed    bool
+}
+
+// NewStreamHub creates a hub whose vehicle streams are started with the given options
+func NewStreamHub(opts *StreamOptions) *StreamHub {
+	return &StreamHub{
+		opts:      opts,
+		upstreams: map[int64]*hubUpstream{},
+	}
+}
+
+// Subscribe adds a subscriber to the vehicle's stream, starting it if needed
+func (h *StreamHub) Subscribe(v Vehicle, opts *SubscribeOptions) (*Subscription, error) {
+	buffer, policy := defaultSubscribeBuffer, DropOldest
+	if opts != nil {
+		if opts.Buffer > 0 {
+			buffer = opts.Buffer
+		}
+		policy = opts.Policy
+	}
+	events := make(chan *StreamEvent, buffer)
+	sub := &Subscription{
+		Events:    events,
+		events:    events,
+		policy:    policy,
+		hub:       h,
+		vehicleID: v.ID,
+		done:      make(chan struct{}),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil, ErrHubClosed
+	}
+	up, ok := h.upstreams[v.ID]
+	if !ok {
+		up = &hubUpstream{
+			stream:      v.ManagedStream(h.opts),
+			subscribers: map[*Subscription]struct{}{},
+		}
+		h.upstreams[v.ID] = up
+		go h.fanOut(up)
+	}
+	up.subscribers[sub] = struct{}{}
+	return sub, nil
+}
+
+// Close closes every subscription and vehicle stream
+func (h *StreamHub) Close() {
+	h.mu.Lock()
+	h.closed = true
+	upstreams := h.upstreams
+	h.upstreams = map[int64]*hubUpstream{}
+	var subs []*Subscription
+	for _, up := range upstreams {
+		for sub := range up.subscribers {
+			subs = append(subs, sub)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.close()
+	}
+	for _, up := range upstreams {
+		up.stream.Close()
+	}
+}
+
+// fanOut delivers each event of the vehicle's stream to its current subscribers
+func (h *StreamHub) fanOut(up *hubUpstream) {
+	for event := range up.stream.Events {
+		h.mu.Lock()
+		subs := make([]*Subscription, 0, len(up.subscribers))
+		for sub := range up.subscribers {
+			subs = append(subs, sub)
+		}
+		h.mu.Unlock()
+
+		for _, sub := range subs {
+			sub.deliver(event)
+		}
+	}
+}
+
+// unsubscribe removes the subscription, closing the vehicle's stream if it was the last one
+func (h *StreamHub) unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	up, ok := h.upstreams[sub.vehicleID]
+	if !ok {
+		h.mu.Unlock()
+		return
+	}
+	delete(up.subscribers, sub)
+	last := len(up.subscribers) == 0
+	if last {
+		delete(h.upstreams, sub.vehicleID)
+	}
+	h.mu.Unlock()
+
+	if last {
+		up.stream.Close()
+	}
+}
+
+// Close ends the subscription
+func (s *Subscription) Close() {
+	s.close()
+	s.hub.unsubscribe(s)
+}
+
+// Dropped returns the number of events discarded because the subscriber's buffer was full
+func (s *Subscription) Dropped() int64 {
+	return atomic.LoadInt64(&s.dropped)
+}
+
+// close unblocks any pending delivery and closes the events channel
+func (s *Subscription) close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.mu.Lock()
+		s.closed = true
+		close(s.events)
+		s.mu.Unlock()
+	})
+}
+
+// deliver sends the event to the subscriber according to its backpressure policy
+func (s *Subscription) deliver(event *StreamEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+
+	switch s.policy {
+	case Block:
+		select {
+		case s.events <- event:
+		case <-s.done:
+		}
+	case DropNewest:
+		select {
+		case s.events <- event:
+		default:
+			atomic.AddInt64(&s.dropped, 1)
+		}
+	default:
+		for {
+			select {
+			case s.events <- event:
+				return
+			default:
+			}
+			select {
+			case <-s.events:
+				atomic.AddInt64(&s.dropped, 1)
+			default:
+			}
+		}
+	}
+}
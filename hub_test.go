@@ -0,0 +1,99 @@
+package tesla
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamHub(t *testing.T) {
+	var mu sync.Mutex
+	var connections int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/oauth/token":
+			w.Write([]byte(`{"access_token": "sometoken123"}`))
+		case "/stream/456/":
+			mu.Lock()
+			connections++
+			n := connections
+			mu.Unlock()
+			if n > 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			for i := 1; i <= 10; i++ {
+				w.Write([]byte(strconv.Itoa(1460905367000+i) + "," + strconv.Itoa(i) + ",9550.3,88,10,76,30.493001,-100.457018,12,D,227,184,75\n"))
+			}
+		}
+	}))
+	defer ts.Close()
+	previousURL := BaseURL
+	BaseURL = ts.URL + "/api/1"
+	previousStreamURL := StreamURL
+	StreamURL = ts.URL
+
+	auth := &Auth{
+		GrantType:    "password",
+		ClientID:     "someclient123",
+		ClientSecret: "somesecret456",
+		Email:        "nobody@example.com",
+		Password:     "pass",
+	}
+	NewClient(auth)
+	vehicle := Vehicle{ID: 123, VehicleID: 456, Tokens: []string{"1"}}
+
+	hub := NewStreamHub(&StreamOptions{MinBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond})
+	// neither of these subscribers read, but they must not stall the others
+	newest, err := hub.Subscribe(vehicle, &SubscribeOptions{Buffer: 2, Policy: DropNewest})
+	assert.Nil(t, err)
+	oldest, err := hub.Subscribe(vehicle, &SubscribeOptions{Buffer: 2, Policy: DropOldest})
+	assert.Nil(t, err)
+	reader, err := hub.Subscribe(vehicle, &SubscribeOptions{Buffer: 1, Policy: Block})
+	assert.Nil(t, err)
+
+	var speeds []int
+	for len(speeds) < 10 {
+		select {
+		case event := <-reader.Events:
+			speeds = append(speeds, *event.Speed)
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for hub events")
+		}
+	}
+	assert.Equal(t, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, speeds)
+	assert.Equal(t, int64(0), reader.Dropped())
+	// the last event may still be on its way to the other subscribers
+	for deadline := time.Now().Add(time.Second); newest.Dropped()+oldest.Dropped() < 16 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+
+	newest.Close()
+	var newestSpeeds []int
+	for event := range newest.Events {
+		newestSpeeds = append(newestSpeeds, *event.Speed)
+	}
+	assert.Equal(t, []int{1, 2}, newestSpeeds)
+	assert.Equal(t, int64(8), newest.Dropped())
+
+	hub.Close()
+	var oldestSpeeds []int
+	for event := range oldest.Events {
+		oldestSpeeds = append(oldestSpeeds, *event.Speed)
+	}
+	assert.Equal(t, []int{9, 10}, oldestSpeeds)
+	assert.Equal(t, int64(8), oldest.Dropped())
+	_, ok := <-reader.Events
+	assert.False(t, ok)
+
+	_, err = hub.Subscribe(vehicle, nil)
+	assert.Equal(t, ErrHubClosed, err)
+
+	BaseURL = previousURL
+	StreamURL = previousStreamURL
+}
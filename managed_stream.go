@@ -0,0 +1,294 @@
+package tesla
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// StreamState is the connection state of a managed stream
+type StreamState int
+
+const (
+	// StreamConnecting is reported before each connection attempt
+	StreamConnecting StreamState = iota
+	// StreamConnected is reported once the streaming API accepts the connection
+	StreamConnected
+	// StreamDisconnected is reported when a connection attempt fails or the connection drops
+	StreamDisconnected
+	// StreamClosed is reported once the stream has been closed and will not reconnect
+	StreamClosed
+)
+
+func (s StreamState) String() string {
+	switch s {
+	case StreamConnecting:
+		return "connecting"
+	case StreamConnected:
+		return "connected"
+	case StreamDisconnected:
+		return "disconnected"
+	case StreamClosed:
+		return "closed"
+	}
+	return "unknown"
+}
+
+// StreamStateChange reports a change in the connection state of a managed stream
+type StreamStateChange struct {
+	State StreamState
+	// Err is the reason for a disconnect, if known
+	Err  error
+	Time time.Time
+}
+
+// StreamTransport selects the streaming API used by a managed stream
+type StreamTransport int
+
+const (
+	// StreamHTTP uses the HTTP long-poll endpoint authenticated with the vehicle's stream tokens
+	StreamHTTP StreamTransport = iota
+	// StreamWebSocket uses the websocket endpoint authenticated with the client's OAuth token
+	StreamWebSocket
+)
+
+// StreamOptions configures a managed stream
+type StreamOptions struct {
+	// Transport defaults to StreamHTTP
+	Transport StreamTransport
+	// Fields to subscribe to; defaults to those in StreamParams
+	Fields []string
+	// Recorder, if set, records every line received
+	Recorder *StreamRecorder
+	// MinBackoff is the delay before the first reconnect attempt
+	MinBackoff time.Duration
+	// MaxBackoff caps the delay between reconnect attempts, which doubles after each failure
+	MaxBackoff time.Duration
+}
+
+// ManagedStream streams events from a vehicle, reconnecting with backoff whenever
+// the connection drops and refreshing the vehicle's stream tokens when they are
+// rejected. Events already received before a reconnect are not delivered again.
+//
+// Errors receives parse errors for lines whose events were dropped or delivered
+// with nil fields. States and Errors are buffered and dropped if not read;
+// Events must be read for the stream to make progress. All channels are closed
+// once the stream is closed.
+type ManagedStream struct {
+	Events chan *StreamEvent
+	States chan *StreamStateChange
+	Errors chan error
+
+	vehicle   Vehicle
+	opts      StreamOptions
+	done      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+	mu        sync.Mutex
+	conn      streamConn
+	last      time.Time
+	stats     StreamStats
+}
+
+var (
+	defaultMinBackoff = time.Second
+	defaultMaxBackoff = 5 * time.Minute
+)
+
+// ManagedStream starts a managed stream from the vehicle
+func (v Vehicle) ManagedStream(opts *StreamOptions) *ManagedStream {
+	s := &ManagedStream{
+		Events:  make(chan *StreamEvent),
+		States:  make(chan *StreamStateChange, 16),
+		Errors:  make(chan error, 16),
+		vehicle: v,
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	if opts != nil {
+		s.opts = *opts
+	}
+	s.opts.Fields = streamFields(s.opts.Fields)
+	if s.opts.MinBackoff <= 0 {
+		s.opts.MinBackoff = defaultMinBackoff
+	}
+	if s.opts.MaxBackoff < s.opts.MinBackoff {
+		s.opts.MaxBackoff = defaultMaxBackoff
+	}
+	go s.run()
+	return s
+}
+
+// Close stops the stream, closes its current connection and waits for the stream to finish
+func (s *ManagedStream) Close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.mu.Lock()
+		if s.conn != nil {
+			s.conn.Close()
+		}
+		s.mu.Unlock()
+	})
+	<-s.stopped
+}
+
+// Tokens returns the vehicle's current stream tokens, which change when they are refreshed
+func (s *ManagedStream) Tokens() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.vehicle.Tokens
+}
+
+// Stats returns counts of the lines received so far and any parse anomalies
+func (s *ManagedStream) Stats() StreamStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+func (s *ManagedStream) run() {
+	defer func() {
+		s.setState(StreamClosed, nil)
+		close(s.Events)
+		close(s.States)
+		close(s.Errors)
+		close(s.stopped)
+	}()
+
+	backoff := s.opts.MinBackoff
+	for {
+		s.setState(StreamConnecting, nil)
+		conn, err := s.dial()
+		if err == nil {
+			s.setState(StreamConnected, nil)
+			var received bool
+			received, err = s.read(conn)
+			conn.Close()
+			if received {
+				backoff = s.opts.MinBackoff
+			}
+		}
+		if s.closed() {
+			return
+		}
+		s.setState(StreamDisconnected, err)
+		if errors.Is(err, ErrStreamUnauthorized) {
+			if err = s.refreshTokens(); err != nil {
+				s.report(err)
+			}
+		}
+
+		select {
+		case <-s.done:
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > s.opts.MaxBackoff {
+			backoff = s.opts.MaxBackoff
+		}
+	}
+}
+
+// dial opens a new connection and keeps it so Close can interrupt reads
+func (s *ManagedStream) dial() (streamConn, error) {
+	s.mu.Lock()
+	vehicle := s.vehicle
+	s.mu.Unlock()
+	var conn streamConn
+	var err error
+	if s.opts.Transport == StreamWebSocket {
+		conn, err = vehicle.dialWebSocketStream(s.opts.Fields)
+	} else {
+		conn, err = vehicle.dialHTTPStream(s.opts.Fields)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed() {
+		conn.Close()
+		return nil, errors.New("stream closed")
+	}
+	s.conn = conn
+	return conn, nil
+}
+
+// read delivers events from the connection until it fails, skipping events that
+// are not newer than the last one delivered
+func (s *ManagedStream) read(conn streamConn) (bool, error) {
+	var received bool
+	for {
+		line, err := conn.ReadLine()
+		if err != nil {
+			return received, err
+		}
+		received = true
+		if s.opts.Recorder != nil {
+			if err = s.opts.Recorder.Record(s.opts.Fields, line, time.Now()); err != nil {
+				s.report(err)
+			}
+		}
+		event, err := parseStreamEvent(line, s.opts.Fields)
+		s.mu.Lock()
+		s.stats.record(line, s.opts.Fields, event, err)
+		s.mu.Unlock()
+		if err != nil {
+			s.report(err)
+		}
+		if event == nil {
+			continue
+		}
+		if !event.Timestamp.After(s.last) {
+			continue
+		}
+		s.last = event.Timestamp
+		select {
+		case s.Events <- event:
+		case <-s.done:
+			return received, nil
+		}
+	}
+}
+
+// refreshTokens fetches the account's vehicles to replace the vehicle's stream tokens
+func (s *ManagedStream) refreshTokens() error {
+	vehicles, err := ActiveClient.Vehicles()
+	if err != nil {
+		return err
+	}
+	for _, vehicle := range vehicles {
+		if vehicle.ID == s.vehicle.ID {
+			s.mu.Lock()
+			s.vehicle.Tokens = vehicle.Tokens
+			s.mu.Unlock()
+			return nil
+		}
+	}
+	return errors.New("vehicle not found while refreshing stream tokens")
+}
+
+func (s *ManagedStream) closed() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *ManagedStream) setState(state StreamState, err error) {
+	select {
+	case s.States <- &StreamStateChange{State: state, Err: err, Time: time.Now()}:
+	default:
+	}
+}
+
+func (s *ManagedStream) report(err error) {
+	select {
+	case s.Errors <- err:
+	default:
+	}
+}
@@ -0,0 +1,90 @@
+package tesla
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManagedStream(t *testing.T) {
+	var mu sync.Mutex
+	var connections int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/oauth/token":
+			w.Write([]byte(`{"access_token": "sometoken123"}`))
+		case "/api/1/vehicles":
+			w.Write([]byte(VehiclesJSON))
+		case "/stream/456/":
+			_, password, _ := req.BasicAuth()
+			if password != "1" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			mu.Lock()
+			connections++
+			n := connections
+			mu.Unlock()
+			switch n {
+			case 1:
+				w.Write([]byte("1460905367000,65,9550.3,88,10,76,30.493001,-100.457018,12,D,227,184,75\n" +
+					"1460905368000,66,9550.4,88,10,76,30.493001,-100.457018,12,D,227,184,75\n"))
+			case 2:
+				// the first event is replayed after reconnecting
+				w.Write([]byte("1460905368000,66,9550.4,88,10,76,30.493001,-100.457018,12,D,227,184,75\n" +
+					"1460905369000,67,9550.5,88,10,76,30.493001,-100.457018,12,D,227,184,75\n"))
+			default:
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}
+	}))
+	defer ts.Close()
+	previousURL := BaseURL
+	BaseURL = ts.URL + "/api/1"
+	previousStreamURL := StreamURL
+	StreamURL = ts.URL
+
+	auth := &Auth{
+		GrantType:    "password",
+		ClientID:     "someclient123",
+		ClientSecret: "somesecret456",
+		Email:        "nobody@example.com",
+		Password:     "pass",
+	}
+	NewClient(auth)
+	vehicle := Vehicle{ID: 123, VehicleID: 456, Tokens: []string{"expired"}}
+
+	stream := vehicle.ManagedStream(&StreamOptions{MinBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond})
+	defer stream.Close()
+	var speeds []int
+	for len(speeds) < 3 {
+		select {
+		case event := <-stream.Events:
+			speeds = append(speeds, *event.Speed)
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for stream events")
+		}
+	}
+	assert.Equal(t, []int{65, 66, 67}, speeds)
+	assert.Equal(t, []string{"1", "2"}, stream.Tokens())
+	stream.Close()
+
+	var states []StreamState
+	for change := range stream.States {
+		states = append(states, change.State)
+	}
+	assert.Equal(t, StreamConnecting, states[0])
+	assert.Equal(t, StreamDisconnected, states[1])
+	assert.Equal(t, StreamConnecting, states[2])
+	assert.Equal(t, StreamConnected, states[3])
+	assert.Equal(t, StreamClosed, states[len(states)-1])
+	_, ok := <-stream.Events
+	assert.False(t, ok)
+
+	BaseURL = previousURL
+	StreamURL = previousStreamURL
+}
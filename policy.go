@@ -0,0 +1,344 @@
+package tesla
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PolicyEffect is what happens to a command matched by a policy rule
+type PolicyEffect string
+
+const (
+	// PolicyDeny blocks the command
+	PolicyDeny PolicyEffect = "deny"
+	// PolicyConfirm blocks the command until it is confirmed with a token
+	PolicyConfirm PolicyEffect = "confirm"
+)
+
+// DefaultConfirmationTTL is how long a confirmation token remains valid
+const DefaultConfirmationTTL = 5 * time.Minute
+
+// Policy decides whether commands may be sent to a vehicle. The first rule that
+// matches a command determines its effect; commands matching no rule are allowed.
+type Policy struct {
+	Rules []PolicyRule `json:"rules"`
+	// ConfirmationTTL overrides DefaultConfirmationTTL when set
+	ConfirmationTTL time.Duration `json:"-"`
+
+	mu      sync.Mutex
+	pending map[string]*confirmation
+	clock   func() time.Time
+}
+
+// PolicyRule matches commands by name, vehicle, time window and location. Empty
+// conditions match everything.
+type PolicyRule struct {
+	Name       string          `json:"name"`
+	Effect     PolicyEffect    `json:"effect"`
+	Commands   []string        `json:"commands,omitempty"`
+	Vehicles   []string        `json:"vehicles,omitempty"`
+	TimeWindow *TimeWindow     `json:"time_window,omitempty"`
+	Location   *PolicyLocation `json:"location,omitempty"`
+}
+
+// TimeWindow is a daily period between two "15:04" clock times, optionally limited
+// to certain days. Windows where End is before Start span midnight.
+type TimeWindow struct {
+	Start    string   `json:"start"`
+	End      string   `json:"end"`
+	Days     []string `json:"days,omitempty"`
+	TimeZone string   `json:"time_zone,omitempty"`
+
+	location *time.Location
+}
+
+// PolicyLocation matches vehicles within a radius of a point, or outside of it when Outside is set
+type PolicyLocation struct {
+	Latitude     float64 `json:"latitude"`
+	Longitude    float64 `json:"longitude"`
+	RadiusMeters float64 `json:"radius_meters"`
+	Outside      bool    `json:"outside,omitempty"`
+}
+
+// PolicyError is returned when a policy rule denies a command
+type PolicyError struct {
+	Rule    string
+	Command string
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("command %q denied by policy rule %q", e.Command, e.Rule)
+}
+
+// ConfirmationRequiredError is returned when a policy rule requires a command to
+// be confirmed. Pass Token to Policy.Confirm and send the command again.
+type ConfirmationRequiredError struct {
+	Rule    string
+	Command string
+	Token   string
+}
+
+func (e *ConfirmationRequiredError) Error() string {
+	return fmt.Sprintf("command %q requires confirmation by policy rule %q", e.Command, e.Rule)
+}
+
+type confirmation struct {
+	vehicleID int64
+	command   string
+	expires   time.Time
+	confirmed bool
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// LoadPolicy reads a JSON policy from the file at the given path
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	policy := &Policy{}
+	if err = json.Unmarshal(data, policy); err != nil {
+		return nil, err
+	}
+	for _, rule := range policy.Rules {
+		if err = rule.check(); err != nil {
+			return nil, err
+		}
+	}
+	return policy, nil
+}
+
+// Confirm approves the command that issued the token, allowing it to be sent once
+// before the token expires
+func (p *Policy) Confirm(token string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	c, ok := p.pending[token]
+	if !ok || p.now().After(c.expires) {
+		return errors.New("unknown or expired confirmation token")
+	}
+	c.confirmed = true
+	return nil
+}
+
+// Evaluate returns an error if the policy blocks the command from being sent to the vehicle
+func (p *Policy) Evaluate(v Vehicle, command string) error {
+	now := p.now()
+	for _, rule := range p.Rules {
+		ok, err := rule.matches(v, command, now)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		switch rule.Effect {
+		case PolicyDeny:
+			return &PolicyError{Rule: rule.Name, Command: command}
+		case PolicyConfirm:
+			return p.confirmation(v, command, rule.Name, now)
+		default:
+			return fmt.Errorf("policy rule %q has unknown effect %q", rule.Name, rule.Effect)
+		}
+	}
+	return nil
+}
+
+// confirmation consumes a confirmed token for the command or issues a new one
+func (p *Policy) confirmation(v Vehicle, command string, rule string, now time.Time) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pending == nil {
+		p.pending = map[string]*confirmation{}
+	}
+	for token, c := range p.pending {
+		if now.After(c.expires) {
+			delete(p.pending, token)
+			continue
+		}
+		if c.confirmed && c.vehicleID == v.ID && c.command == command {
+			delete(p.pending, token)
+			return nil
+		}
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	token := hex.EncodeToString(b)
+	ttl := p.ConfirmationTTL
+	if ttl == 0 {
+		ttl = DefaultConfirmationTTL
+	}
+	p.pending[token] = &confirmation{vehicleID: v.ID, command: command, expires: now.Add(ttl)}
+	return &ConfirmationRequiredError{Rule: rule, Command: command, Token: token}
+}
+
+func (p *Policy) now() time.Time {
+	if p.clock != nil {
+		return p.clock()
+	}
+	return time.Now()
+}
+
+// check validates the rule's effect and time window, and loads the window's time zone
+func (r PolicyRule) check() error {
+	if r.Effect != PolicyDeny && r.Effect != PolicyConfirm {
+		return fmt.Errorf("policy rule %q has unknown effect %q", r.Name, r.Effect)
+	}
+	if r.TimeWindow != nil {
+		if err := r.TimeWindow.validate(); err != nil {
+			return fmt.Errorf("policy rule %q: %v", r.Name, err)
+		}
+		r.TimeWindow.location, _ = r.TimeWindow.zone()
+	}
+	return nil
+}
+
+// matches reports whether every condition of the rule holds for the command. The
+// vehicle's location is only fetched when the other conditions match.
+func (r PolicyRule) matches(v Vehicle, command string, now time.Time) (bool, error) {
+	if len(r.Commands) > 0 && !containsString(r.Commands, command) {
+		return false, nil
+	}
+	if len(r.Vehicles) > 0 && !v.identifiedBy(r.Vehicles...) {
+		return false, nil
+	}
+	if r.TimeWindow != nil {
+		// rules built without LoadPolicy have not been checked
+		if err := r.TimeWindow.validate(); err != nil {
+			return false, err
+		}
+		if !r.TimeWindow.contains(now) {
+			return false, nil
+		}
+	}
+	if r.Location != nil {
+		driveState, err := v.DriveState()
+		if err != nil {
+			return false, err
+		}
+		inside := distanceMeters(r.Location.Latitude, r.Location.Longitude, driveState.Latitude, driveState.Longitude) <= r.Location.RadiusMeters
+		if inside == r.Location.Outside {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// validate checks the window's clock times, days and time zone
+func (w TimeWindow) validate() error {
+	start, err := parseClock(w.Start)
+	if err != nil {
+		return err
+	}
+	end, err := parseClock(w.End)
+	if err != nil {
+		return err
+	}
+	if start == end {
+		return fmt.Errorf("time window starts and ends at %s", w.Start)
+	}
+	for _, name := range w.Days {
+		if _, ok := weekdays[strings.ToLower(name)]; !ok {
+			return fmt.Errorf("unknown day %q", name)
+		}
+	}
+	_, err = w.zone()
+	return err
+}
+
+// zone returns the window's time zone, or nil to use that of the times checked.
+// Windows of rules read by LoadPolicy have it loaded already.
+func (w TimeWindow) zone() (*time.Location, error) {
+	if w.location != nil || w.TimeZone == "" {
+		return w.location, nil
+	}
+	return time.LoadLocation(w.TimeZone)
+}
+
+// contains reports whether t falls within the window, which must be valid
+func (w TimeWindow) contains(t time.Time) bool {
+	if location, _ := w.zone(); location != nil {
+		t = t.In(location)
+	}
+	start, _ := parseClock(w.Start)
+	end, _ := parseClock(w.End)
+
+	minute := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	var inside bool
+	if start <= end {
+		inside = minute >= start && minute < end
+	} else {
+		// the window spans midnight, so the early part belongs to the previous day
+		inside = minute >= start || minute < end
+		if minute < end {
+			day = (day + 6) % 7
+		}
+	}
+	if !inside || len(w.Days) == 0 {
+		return inside
+	}
+	for _, name := range w.Days {
+		if d, ok := weekdays[strings.ToLower(name)]; ok && d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// parseClock converts a "15:04" clock time to minutes after midnight
+func parseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("invalid clock time %q", clock)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// identifiedBy reports whether any of the names is the vehicle's ID, VIN or display name
+func (v Vehicle) identifiedBy(names ...string) bool {
+	return containsString(names, strconv.FormatInt(v.ID, 10)) ||
+		containsString(names, v.Vin) ||
+		containsString(names, v.DisplayName)
+}
+
+func containsString(values []string, s string) bool {
+	for _, value := range values {
+		if value == s {
+			return true
+		}
+	}
+	return false
+}
+
+// distanceMeters returns the great-circle distance between two coordinates
+func distanceMeters(lat1, lng1, lat2, lng2 float64) float64 {
+	const earthRadius = 6371000.0
+	toRadians := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := toRadians(lat2 - lat1)
+	dLng := toRadians(lng2 - lng1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRadians(lat1))*math.Cos(toRadians(lat2))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return earthRadius * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
@@ -0,0 +1,113 @@
+package tesla
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var PolicyJSON = `{"rules":[
+	{"name":"no unlock","effect":"deny","commands":["door_unlock"],"vehicles":["abc123"]},
+	{"name":"confirm start","effect":"confirm","commands":["remote_start_drive"]},
+	{"name":"quiet hours","effect":"deny","commands":["honk_horn"],"time_window":{"start":"22:00","end":"07:00","days":["fri"]}},
+	{"name":"away from home","effect":"deny","commands":["trigger_homelink"],"location":{"latitude":3.6,"longitude":-149.1,"radius_meters":100,"outside":true}},
+	{"name":"at home","effect":"deny","commands":["flash_lights"],"location":{"latitude":3.6,"longitude":-149.1,"radius_meters":100}}
+]}`
+
+func TestPolicy(t *testing.T) {
+	ts := serveHTTP(t)
+	defer ts.Close()
+	previousURL := BaseURL
+	BaseURL = ts.URL + "/api/1"
+
+	file, err := ioutil.TempFile("", "policy")
+	assert.Nil(t, err)
+	defer os.Remove(file.Name())
+	file.WriteString(PolicyJSON)
+	file.Close()
+
+	policy, err := LoadPolicy(file.Name())
+	assert.Nil(t, err)
+	assert.Len(t, policy.Rules, 5)
+	// Saturday 01:30, inside the window that started on Friday
+	now := time.Date(2020, 6, 13, 1, 30, 0, 0, time.Local)
+	policy.clock = func() time.Time { return now }
+
+	auth := &Auth{
+		GrantType:    "password",
+		ClientID:     "someclient123",
+		ClientSecret: "somesecret456",
+		Email:        "nobody@example.com",
+		Password:     "pass",
+	}
+	client, _ := NewClient(auth)
+	client.Policy = policy
+	vehicles, err := client.Vehicles()
+	assert.Nil(t, err)
+	vehicle := vehicles[0]
+
+	err = vehicle.UnlockDoors()
+	assert.Equal(t, `command "door_unlock" denied by policy rule "no unlock"`, err.Error())
+	assert.Nil(t, vehicle.LockDoors())
+
+	err = vehicle.HonkHorn()
+	assert.IsType(t, &PolicyError{}, err)
+	now = time.Date(2020, 6, 14, 1, 30, 0, 0, time.Local)
+	assert.Nil(t, vehicle.HonkHorn())
+
+	assert.Nil(t, vehicle.ToggleHomelink())
+	assert.IsType(t, &PolicyError{}, vehicle.FlashLights())
+
+	err = vehicle.Start("pass")
+	confirmationErr, ok := err.(*ConfirmationRequiredError)
+	assert.True(t, ok)
+	assert.Equal(t, "confirm start", confirmationErr.Rule)
+	assert.NotEmpty(t, confirmationErr.Token)
+	assert.Nil(t, policy.Confirm(confirmationErr.Token))
+	assert.Nil(t, vehicle.Start("pass"))
+	// a confirmation only allows a single command
+	assert.IsType(t, &ConfirmationRequiredError{}, vehicle.Start("pass"))
+	assert.NotNil(t, policy.Confirm(confirmationErr.Token))
+
+	err = vehicle.Start("pass")
+	token := err.(*ConfirmationRequiredError).Token
+	now = now.Add(DefaultConfirmationTTL + time.Second)
+	assert.Equal(t, "unknown or expired confirmation token", policy.Confirm(token).Error())
+
+	BaseURL = previousURL
+}
+
+func TestTimeWindow(t *testing.T) {
+	window := TimeWindow{Start: "09:00", End: "17:00", Days: []string{"mon", "tue"}}
+	assert.Nil(t, window.validate())
+	assert.True(t, window.contains(time.Date(2020, 6, 15, 12, 0, 0, 0, time.Local)))
+	assert.False(t, window.contains(time.Date(2020, 6, 15, 17, 0, 0, 0, time.Local)))
+	assert.False(t, window.contains(time.Date(2020, 6, 17, 12, 0, 0, 0, time.Local)))
+
+	window = TimeWindow{Start: "9am", End: "17:00"}
+	assert.Equal(t, `invalid clock time "9am"`, window.validate().Error())
+	window = TimeWindow{Start: "09:00", End: "17:00", TimeZone: "Mars/Olympus_Mons"}
+	assert.NotNil(t, window.validate())
+	window = TimeWindow{Start: "09:00", End: "09:00"}
+	assert.EqualError(t, window.validate(), "time window starts and ends at 09:00")
+
+	// the time zone is loaded once, when the policy is read
+	policy, err := LoadPolicy(writeTemp(t, `{"rules":[{"name":"night","effect":"deny","time_window":{"start":"22:00","end":"06:00","time_zone":"Asia/Tokyo"}}]}`))
+	assert.Nil(t, err)
+	window = *policy.Rules[0].TimeWindow
+	if assert.NotNil(t, window.location) {
+		assert.Equal(t, "Asia/Tokyo", window.location.String())
+	}
+	// 23:00 in Tokyo
+	assert.True(t, window.contains(time.Date(2020, 6, 15, 14, 0, 0, 0, time.UTC)))
+	assert.False(t, window.contains(time.Date(2020, 6, 15, 23, 0, 0, 0, time.UTC)))
+
+	// days are checked whatever the time, not only once the window is entered
+	for _, hours := range []string{`"start":"00:00","end":"00:01"`, `"start":"00:00","end":"23:59"`} {
+		_, err := LoadPolicy(writeTemp(t, `{"rules":[{"name":"typo","effect":"deny","time_window":{`+hours+`,"days":["mnday"]}}]}`))
+		assert.EqualError(t, err, `policy rule "typo": unknown day "mnday"`)
+	}
+}
@@ -0,0 +1,173 @@
+package tesla
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReplayMaxSpeed replays a recording as fast as events can be read
+const ReplayMaxSpeed = 0
+
+// ErrReplayFinished is sent on the error channel once a replay reaches the end of its recording
+var ErrReplayFinished = errors.New("stream replay finished")
+
+// recordingFieldsPrefix starts the header line listing the fields of the lines that follow
+const recordingFieldsPrefix = "#fields\t"
+
+// StreamRecorder writes raw stream lines with the time they were received. Each
+// line of a recording is the receive time in Unix milliseconds, a tab and the
+// raw line, preceded by a header listing the stream's fields.
+type StreamRecorder struct {
+	w      io.Writer
+	closer io.Closer
+	mu     sync.Mutex
+	fields string
+}
+
+// NewStreamRecorder records to the given writer
+func NewStreamRecorder(w io.Writer) *StreamRecorder {
+	return &StreamRecorder{w: w}
+}
+
+// CreateStreamRecording creates, or truncates, the file at the given path and records to it
+func CreateStreamRecording(path string) (*StreamRecorder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &StreamRecorder{w: file, closer: file}, nil
+}
+
+// Record writes a line received from a stream of the given fields
+func (r *StreamRecorder) Record(fields []string, line string, received time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if header := strings.Join(fields, ","); header != r.fields {
+		if _, err := io.WriteString(r.w, recordingFieldsPrefix+header+"\n"); err != nil {
+			return err
+		}
+		r.fields = header
+	}
+	ms := received.UnixNano() / int64(time.Millisecond)
+	_, err := io.WriteString(r.w, strconv.FormatInt(ms, 10)+"\t"+line+"\n")
+	return err
+}
+
+// Close closes the recording file, if the recorder created one
+func (r *StreamRecorder) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+// StreamReplayer feeds a recording back as stream events
+type StreamReplayer struct {
+	file      *os.File
+	scanner   *bufio.Scanner
+	fields    []string
+	speed     float64
+	previous  time.Time
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// OpenStreamRecording opens the recording at the given path for replay
+func OpenStreamRecording(path string) (*StreamReplayer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(file)
+	if !scanner.Scan() || !strings.HasPrefix(scanner.Text(), recordingFieldsPrefix) {
+		file.Close()
+		return nil, errors.New("stream recording has no fields header")
+	}
+	return &StreamReplayer{
+		file:    file,
+		scanner: scanner,
+		fields:  strings.Split(strings.TrimPrefix(scanner.Text(), recordingFieldsPrefix), ","),
+		done:    make(chan struct{}),
+	}, nil
+}
+
+// Replay sends the recording's events in the form of go channels, like Stream.
+// A speed of 1 keeps the original timing between lines, higher speeds shorten
+// it and ReplayMaxSpeed removes it. ErrReplayFinished is sent once the end of
+// the recording is reached, even if a parse error is still unread, and the
+// event channel is then closed.
+func (r *StreamReplayer) Replay(speed float64) (chan *StreamEvent, chan error) {
+	r.speed = speed
+	eventChan := make(chan *StreamEvent)
+	errChan := make(chan error, 1)
+	go readStream(r, r.fields, eventChan, errChan)
+	return eventChan, errChan
+}
+
+// ReadLine returns the next recorded line once it is due
+func (r *StreamReplayer) ReadLine() (string, error) {
+	for r.scanner.Scan() {
+		text := r.scanner.Text()
+		if strings.HasPrefix(text, recordingFieldsPrefix) {
+			if strings.TrimPrefix(text, recordingFieldsPrefix) != strings.Join(r.fields, ",") {
+				return "", errors.New("stream recording changes fields during replay")
+			}
+			continue
+		}
+		parts := strings.SplitN(text, "\t", 2)
+		if len(parts) != 2 {
+			return "", fmt.Errorf("invalid stream recording line: %q", text)
+		}
+		ms, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid stream recording line: %q", text)
+		}
+		received := time.Unix(0, ms*int64(time.Millisecond))
+		if err = r.wait(received); err != nil {
+			return "", err
+		}
+		return parts[1], nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", ErrReplayFinished
+}
+
+// wait sleeps for the time between the previous line and this one, scaled by the replay speed
+func (r *StreamReplayer) wait(received time.Time) error {
+	previous := r.previous
+	r.previous = received
+	if previous.IsZero() || r.speed <= ReplayMaxSpeed {
+		return nil
+	}
+	delay := time.Duration(float64(received.Sub(previous)) / r.speed)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-r.done:
+		return errors.New("stream replay closed")
+	}
+}
+
+// Close stops the replay and closes the recording
+func (r *StreamReplayer) Close() error {
+	var err error
+	r.closeOnce.Do(func() {
+		close(r.done)
+		err = r.file.Close()
+	})
+	return err
+}
@@ -0,0 +1,96 @@
+package tesla
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordReplay(t *testing.T) {
+	ts := serveHTTP(t)
+	defer ts.Close()
+	previousURL := BaseURL
+	BaseURL = ts.URL + "/api/1"
+	previousStreamURL := StreamURL
+	StreamURL = ts.URL
+
+	auth := &Auth{
+		GrantType:    "password",
+		ClientID:     "someclient123",
+		ClientSecret: "somesecret456",
+		Email:        "nobody@example.com",
+		Password:     "pass",
+	}
+	NewClient(auth)
+	vehicle := Vehicle{ID: 123, VehicleID: 123, Tokens: []string{"456"}}
+
+	// lines received by a managed stream are recorded as they arrive
+	var buffer bytes.Buffer
+	stream := vehicle.ManagedStream(&StreamOptions{Recorder: NewStreamRecorder(&buffer), MinBackoff: time.Hour})
+	<-stream.Events
+	stream.Close()
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	assert.Equal(t, "#fields\t"+StreamParams, lines[0])
+	assert.True(t, strings.HasSuffix(lines[1], "\t"+StreamEventString))
+
+	dir, err := ioutil.TempDir("", "recording")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "drive.rec")
+	recorder, err := CreateStreamRecording(path)
+	assert.Nil(t, err)
+	fields := []string{"speed", "shift_state"}
+	start := time.Unix(1460905367, 0)
+	assert.Nil(t, recorder.Record(fields, "1460905367000,0,P", start))
+	assert.Nil(t, recorder.Record(fields, "1460905368000,10,D", start.Add(time.Second)))
+	assert.Nil(t, recorder.Record(fields, "1460905369000,20,D", start.Add(2*time.Second)))
+	assert.Nil(t, recorder.Close())
+
+	replayer, err := OpenStreamRecording(path)
+	assert.Nil(t, err)
+	eventChan, errChan := replayer.Replay(ReplayMaxSpeed)
+	var speeds []int
+	for i := 0; i < 3; i++ {
+		speeds = append(speeds, *(<-eventChan).Speed)
+	}
+	assert.Equal(t, []int{0, 10, 20}, speeds)
+	assert.Equal(t, ErrReplayFinished, <-errChan)
+
+	// at 20x the two second recording takes about 100ms
+	replayer, err = OpenStreamRecording(path)
+	assert.Nil(t, err)
+	began := time.Now()
+	eventChan, errChan = replayer.Replay(20)
+	for i := 0; i < 3; i++ {
+		<-eventChan
+	}
+	elapsed := time.Since(began)
+	assert.True(t, elapsed >= 90*time.Millisecond, elapsed)
+	assert.True(t, elapsed < time.Second, elapsed)
+	assert.Equal(t, ErrReplayFinished, <-errChan)
+
+	// a bad line just before the end does not hide that the replay finished
+	ioutil.WriteFile(path, []byte("#fields\tspeed,shift_state\n1460905367000\t1460905367000,0,P\n1460905368000\tgarbage\n"), 0600)
+	replayer, err = OpenStreamRecording(path)
+	assert.Nil(t, err)
+	eventChan, errChan = replayer.Replay(ReplayMaxSpeed)
+	var events int
+	for range eventChan {
+		events++
+	}
+	assert.Equal(t, 1, events)
+	assert.Equal(t, ErrReplayFinished, <-errChan)
+
+	ioutil.WriteFile(path, []byte("1460905367000\t1460905367000,0,P\n"), 0600)
+	_, err = OpenStreamRecording(path)
+	assert.Equal(t, "stream recording has no fields header", err.Error())
+
+	BaseURL = previousURL
+	StreamURL = previousStreamURL
+}
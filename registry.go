@@ -0,0 +1,237 @@
+package tesla
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Capability is a feature a vehicle must support before a command can be sent to it
+type Capability string
+
+const (
+	// CapabilityRemoteStart requires remote start to be enabled for the vehicle
+	CapabilityRemoteStart Capability = "remote_start"
+	// CapabilitySunRoof requires the vehicle to have a panoramic roof installed
+	CapabilitySunRoof Capability = "sun_roof"
+)
+
+// Command describes a command that can be sent to a vehicle
+type Command struct {
+	// Name identifies the command when calling Execute
+	Name string
+	// Endpoint is the path of the command relative to the vehicle's URL
+	Endpoint string
+	// Payload returns a new, empty request for the command's arguments; nil if the command takes none
+	Payload func() interface{}
+	// Capabilities the vehicle must support for the command to be sent
+	Capabilities []Capability
+	// Idempotent commands have the same effect no matter how many times they are sent
+	Idempotent bool
+
+	// prepare fills in any part of the payload that is derived from the vehicle rather than the caller
+	prepare func(v Vehicle, payload interface{}) error
+	// derived lists the arguments prepare fills in, which callers can't set
+	derived []string
+	// verify re-reads the vehicle's state and reports whether the command took effect
+	verify func(v Vehicle, payload interface{}) (bool, error)
+}
+
+var commandTable = []Command{
+	{Name: "auto_conditioning_start", Endpoint: "command/auto_conditioning_start", Idempotent: true, verify: verifyClimate(true)},
+	{Name: "auto_conditioning_stop", Endpoint: "command/auto_conditioning_stop", Idempotent: true, verify: verifyClimate(false)},
+	{Name: "autopark_abort", Endpoint: "command/autopark_request", Payload: newAutoParkRequest, Idempotent: true, prepare: prepareAutoPark("abort"), derived: autoParkArgs},
+	{Name: "autopark_forward", Endpoint: "command/autopark_request", Payload: newAutoParkRequest, prepare: prepareAutoPark("start_forward"), derived: autoParkArgs},
+	{Name: "autopark_reverse", Endpoint: "command/autopark_request", Payload: newAutoParkRequest, prepare: prepareAutoPark("start_reverse"), derived: autoParkArgs},
+	{Name: "charge_max_range", Endpoint: "command/charge_max_range", Idempotent: true},
+	{Name: "charge_port_door_open", Endpoint: "command/charge_port_door_open", Idempotent: true},
+	{Name: "charge_standard", Endpoint: "command/charge_standard", Idempotent: true},
+	{Name: "charge_start", Endpoint: "command/charge_start", Idempotent: true, verify: verifyCharging(true)},
+	{Name: "charge_stop", Endpoint: "command/charge_stop", Idempotent: true, verify: verifyCharging(false)},
+	{Name: "door_lock", Endpoint: "command/door_lock", Idempotent: true, verify: verifyLocked(true)},
+	{Name: "door_unlock", Endpoint: "command/door_unlock", Idempotent: true, verify: verifyLocked(false)},
+	{Name: "flash_lights", Endpoint: "command/flash_lights"},
+	{Name: "honk_horn", Endpoint: "command/honk_horn"},
+	{Name: "remote_start_drive", Endpoint: "command/remote_start_drive", Payload: func() interface{} { return &RemoteStartRequest{} }, Capabilities: []Capability{CapabilityRemoteStart}},
+	{Name: "reset_valet_pin", Endpoint: "command/reset_valet_pin", Idempotent: true},
+	{Name: "set_charge_limit", Endpoint: "command/set_charge_limit", Payload: func() interface{} { return &ChargeLimitRequest{} }, Idempotent: true, verify: verifyChargeLimit},
+	{Name: "set_charging_amps", Endpoint: "command/set_charging_amps", Payload: func() interface{} { return &ChargingAmpsRequest{} }, Idempotent: true, verify: verifyChargingAmps},
+	{Name: "set_temps", Endpoint: "command/set_temps", Payload: func() interface{} { return &TemperatureRequest{} }, Idempotent: true},
+	{Name: "sun_roof_control", Endpoint: "command/sun_roof_control", Payload: func() interface{} { return &RoofRequest{} }, Capabilities: []Capability{CapabilitySunRoof}, Idempotent: true},
+	{Name: "trigger_homelink", Endpoint: "command/trigger_homelink", Payload: newAutoParkRequest, prepare: prepareHomelink, derived: autoParkArgs},
+	{Name: "trunk_open", Endpoint: "command/trunk_open", Payload: func() interface{} { return &TrunkRequest{} }},
+	{Name: "wake_up", Endpoint: "wake_up", Idempotent: true},
+}
+
+// autoParkArgs are the arguments of autopark and homelink requests, all of which
+// come from the vehicle
+var autoParkArgs = []string{"action", "lat", "lon", "vehicle_id"}
+
+// Commands returns every command that can be sent with Execute, ordered by name
+func Commands() []Command {
+	commands := make([]Command, len(commandTable))
+	copy(commands, commandTable)
+	sort.Slice(commands, func(i, j int) bool { return commands[i].Name < commands[j].Name })
+	return commands
+}
+
+// LookupCommand returns the command registered under the given name
+func LookupCommand(name string) (Command, bool) {
+	for _, cmd := range commandTable {
+		if cmd.Name == name {
+			return cmd, true
+		}
+	}
+	return Command{}, false
+}
+
+// Args returns the names of the arguments accepted by the command, leaving out
+// those filled in from the vehicle
+func (c Command) Args() []string {
+	if c.Payload == nil {
+		return nil
+	}
+	t := reflect.TypeOf(c.Payload()).Elem()
+	var args []string
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" && !containsString(c.derived, name) {
+			args = append(args, name)
+		}
+	}
+	return args
+}
+
+// decode converts generic arguments into the command's payload, rejecting unknown arguments
+func (c Command) decode(args map[string]interface{}) (interface{}, error) {
+	if c.Payload == nil {
+		if len(args) > 0 {
+			return nil, fmt.Errorf("command %q takes no arguments", c.Name)
+		}
+		return nil, nil
+	}
+	payload := c.Payload()
+	if len(args) == 0 {
+		return payload, nil
+	}
+	for name := range args {
+		if containsString(c.derived, name) {
+			return nil, fmt.Errorf("argument %q of command %q is filled in from the vehicle", name, c.Name)
+		}
+	}
+	data, err := json.Marshal(args)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(payload); err != nil {
+		return nil, fmt.Errorf("invalid arguments for command %q: %v", c.Name, err)
+	}
+	return payload, nil
+}
+
+// Execute sends the named command to the vehicle with the given arguments
+func (v Vehicle) Execute(ctx context.Context, name string, args map[string]interface{}) (*CommandResponse, error) {
+	cmd, ok := LookupCommand(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown command %q", name)
+	}
+	payload, err := cmd.decode(args)
+	if err != nil {
+		return nil, err
+	}
+	body, err := v.send(ctx, cmd, payload)
+	if err != nil {
+		return nil, err
+	}
+	return parseCommandResponse(body)
+}
+
+// checkCapabilities returns an error if the vehicle lacks a capability required by the command
+func (v Vehicle) checkCapabilities(cmd Command) error {
+	for _, capability := range cmd.Capabilities {
+		switch capability {
+		case CapabilityRemoteStart:
+			if !v.RemoteStartEnabled {
+				return fmt.Errorf("command %q requires remote start to be enabled", cmd.Name)
+			}
+		case CapabilitySunRoof:
+			vehicleState, err := v.VehicleState()
+			if err != nil {
+				return err
+			}
+			if vehicleState.SunRoofInstalled == 0 {
+				return fmt.Errorf("command %q requires a sun roof", cmd.Name)
+			}
+		default:
+			return fmt.Errorf("command %q requires unknown capability %q", cmd.Name, capability)
+		}
+	}
+	return nil
+}
+
+// parseCommandResponse decodes a command's response body. Endpoints that do not
+// report a result, such as wake_up, are treated as successful.
+func parseCommandResponse(body []byte) (*CommandResponse, error) {
+	response := &CommandResponse{}
+	if len(body) == 0 {
+		response.Response.Result = true
+		return response, nil
+	}
+	raw := &struct {
+		Response json.RawMessage `json:"response"`
+	}{}
+	if err := json.Unmarshal(body, raw); err != nil {
+		return nil, err
+	}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(raw.Response, &fields); err != nil {
+		return nil, errors.New("unexpected command response")
+	}
+	if _, ok := fields["result"]; !ok {
+		response.Response.Result = true
+		return response, nil
+	}
+	if err := json.Unmarshal(body, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func newAutoParkRequest() interface{} {
+	return &AutoParkRequest{}
+}
+
+// prepareAutoPark fills in the vehicle ID and its current location for an autopark request
+func prepareAutoPark(action string) func(Vehicle, interface{}) error {
+	return func(v Vehicle, payload interface{}) error {
+		driveState, err := v.DriveState()
+		if err != nil {
+			return err
+		}
+		autoParkRequest := payload.(*AutoParkRequest)
+		autoParkRequest.Action = action
+		autoParkRequest.VehicleID = v.VehicleID
+		autoParkRequest.Lat = driveState.Latitude
+		autoParkRequest.Lon = driveState.Longitude
+		return nil
+	}
+}
+
+// prepareHomelink fills in the vehicle's current location for a homelink request
+func prepareHomelink(v Vehicle, payload interface{}) error {
+	driveState, err := v.DriveState()
+	if err != nil {
+		return err
+	}
+	homelinkRequest := payload.(*AutoParkRequest)
+	homelinkRequest.Lat = driveState.Latitude
+	homelinkRequest.Lon = driveState.Longitude
+	return nil
+}
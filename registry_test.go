@@ -0,0 +1,96 @@
+package tesla
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	ts := serveHTTP(t)
+	defer ts.Close()
+	previousURL := BaseURL
+	BaseURL = ts.URL + "/api/1"
+
+	auth := &Auth{
+		GrantType:    "password",
+		ClientID:     "someclient123",
+		ClientSecret: "somesecret456",
+		Email:        "nobody@example.com",
+		Password:     "pass",
+	}
+	client, _ := NewClient(auth)
+	vehicles, err := client.Vehicles()
+	assert.Nil(t, err)
+	vehicle := vehicles[0]
+
+	commands := Commands()
+	assert.Equal(t, len(commandTable), len(commands))
+	for i := 1; i < len(commands); i++ {
+		assert.True(t, commands[i-1].Name < commands[i].Name)
+	}
+
+	cmd, ok := LookupCommand("set_temps")
+	assert.True(t, ok)
+	assert.Equal(t, "command/set_temps", cmd.Endpoint)
+	assert.Equal(t, []string{"driver_temp", "passenger_temp"}, cmd.Args())
+	assert.True(t, cmd.Idempotent)
+
+	cmd, _ = LookupCommand("honk_horn")
+	assert.Nil(t, cmd.Args())
+	assert.False(t, cmd.Idempotent)
+
+	_, ok = LookupCommand("self_destruct")
+	assert.False(t, ok)
+
+	ctx := context.Background()
+	response, err := vehicle.Execute(ctx, "door_lock", nil)
+	assert.Nil(t, err)
+	assert.True(t, response.Response.Result)
+
+	response, err = vehicle.Execute(ctx, "set_temps", map[string]interface{}{"driver_temp": 20.1, "passenger_temp": 23.4})
+	assert.Nil(t, err)
+	assert.True(t, response.Response.Result)
+
+	response, err = vehicle.Execute(ctx, "wake_up", nil)
+	assert.Nil(t, err)
+	assert.True(t, response.Response.Result)
+
+	_, err = vehicle.Execute(ctx, "autopark_forward", nil)
+	assert.Nil(t, err)
+
+	_, err = vehicle.Execute(ctx, "charge_standard", nil)
+	assert.Equal(t, "already_standard", err.Error())
+
+	_, err = vehicle.Execute(ctx, "set_charge_limit", map[string]interface{}{"percent": 10})
+	assert.Equal(t, "charge limit 10 outside of allowed range 50-100", err.Error())
+
+	_, err = vehicle.Execute(ctx, "set_charge_limit", map[string]interface{}{"limit": 80})
+	assert.Contains(t, err.Error(), `invalid arguments for command "set_charge_limit"`)
+
+	_, err = vehicle.Execute(ctx, "door_lock", map[string]interface{}{"percent": 10})
+	assert.Equal(t, `command "door_lock" takes no arguments`, err.Error())
+
+	_, err = vehicle.Execute(ctx, "self_destruct", nil)
+	assert.Equal(t, `unknown command "self_destruct"`, err.Error())
+
+	vehicle.RemoteStartEnabled = false
+	_, err = vehicle.Execute(ctx, "remote_start_drive", map[string]interface{}{"password": "pass"})
+	assert.Equal(t, `command "remote_start_drive" requires remote start to be enabled`, err.Error())
+	// the typed methods check capabilities too
+	assert.Equal(t, err, vehicle.Start("pass"))
+
+	// arguments filled in from the vehicle can't be set
+	cmd, _ = LookupCommand("trigger_homelink")
+	assert.Empty(t, cmd.Args())
+	_, err = vehicle.Execute(ctx, "autopark_forward", map[string]interface{}{"lat": 1})
+	assert.Equal(t, `argument "lat" of command "autopark_forward" is filled in from the vehicle`, err.Error())
+
+	for _, name := range []string{"trunk_open", "remote_start_drive"} {
+		cmd, _ = LookupCommand(name)
+		assert.False(t, cmd.Idempotent, name)
+	}
+
+	BaseURL = previousURL
+}
@@ -0,0 +1,397 @@
+package tesla
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ScheduledCommand sends a command to a vehicle each time its cron schedule fires
+type ScheduledCommand struct {
+	ID string `json:"id"`
+	// Vehicle is the vehicle's ID, VIN or display name
+	Vehicle string `json:"vehicle"`
+	// Schedule is a cron schedule, see ParseSchedule
+	Schedule string `json:"schedule"`
+	// TimeZone the schedule is evaluated in; defaults to the local time zone
+	TimeZone string                 `json:"time_zone,omitempty"`
+	Command  string                 `json:"command"`
+	Args     map[string]interface{} `json:"args,omitempty"`
+	// Created is when the command was scheduled; it is set by Add
+	Created time.Time `json:"created"`
+	// LastRun is when the schedule last fired, whether or not the command was sent
+	LastRun *time.Time `json:"last_run,omitempty"`
+	// Outcomes of the most recent runs, oldest first
+	Outcomes []*ScheduleOutcome `json:"outcomes,omitempty"`
+
+	schedule *Schedule
+	location *time.Location
+}
+
+// ScheduleOutcome records what happened when a scheduled command was due
+type ScheduleOutcome struct {
+	// Due is the time the schedule fired
+	Due time.Time `json:"due"`
+	// Time is when the command was run or skipped
+	Time time.Time `json:"time"`
+	// Woke is set when the vehicle had to be woken up first
+	Woke bool `json:"woke,omitempty"`
+	// Skipped is set when the run was missed by more than the scheduler's MaxDelay
+	Skipped bool   `json:"skipped,omitempty"`
+	Result  bool   `json:"result"`
+	Reason  string `json:"reason,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// SchedulerOptions configures a scheduler
+type SchedulerOptions struct {
+	// MaxDelay is how late a run may start, such as after the scheduler was not
+	// running, before it is skipped; defaults to 5 minutes
+	MaxDelay time.Duration
+	// WakeTimeout is how long to wait for the vehicle to wake up; defaults to 2 minutes
+	WakeTimeout time.Duration
+	// WakeInterval is the delay between checks that the vehicle is awake; defaults to 5 seconds
+	WakeInterval time.Duration
+}
+
+// scheduleHistoryLimit is the number of outcomes kept for each scheduled command
+const scheduleHistoryLimit = 20
+
+var (
+	defaultScheduleMaxDelay = 5 * time.Minute
+	defaultWakeTimeout      = 2 * time.Minute
+	defaultWakeInterval     = 5 * time.Second
+)
+
+// Scheduler sends commands to vehicles on cron schedules. Scheduled commands
+// and their outcomes are saved to a JSON file, so runs missed while the
+// scheduler is stopped are caught up, or skipped if too late, when it restarts.
+// Vehicles are woken up before commands are sent to them.
+type Scheduler struct {
+	path      string
+	opts      SchedulerOptions
+	runMu     sync.Mutex
+	mu        sync.Mutex
+	commands  []*ScheduledCommand
+	done      chan struct{}
+	stopped   chan struct{}
+	startOnce sync.Once
+	closeOnce sync.Once
+}
+
+// schedulerFile is the layout of a scheduler's file
+type schedulerFile struct {
+	Commands []*ScheduledCommand `json:"commands"`
+}
+
+// NewScheduler creates a scheduler saving to the file at the given path,
+// loading the commands already scheduled in it
+func NewScheduler(path string, opts *SchedulerOptions) (*Scheduler, error) {
+	s := &Scheduler{
+		path:    path,
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	if opts != nil {
+		s.opts = *opts
+	}
+	if s.opts.MaxDelay <= 0 {
+		s.opts.MaxDelay = defaultScheduleMaxDelay
+	}
+	if s.opts.WakeTimeout <= 0 {
+		s.opts.WakeTimeout = defaultWakeTimeout
+	}
+	if s.opts.WakeInterval <= 0 {
+		s.opts.WakeInterval = defaultWakeInterval
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	file := &schedulerFile{}
+	if err = json.Unmarshal(data, file); err != nil {
+		return nil, err
+	}
+	for _, cmd := range file.Commands {
+		if err = cmd.check(); err != nil {
+			return nil, err
+		}
+	}
+	s.commands = file.Commands
+	return s, nil
+}
+
+// Add schedules the command, assigning it an ID if it has none, and saves the schedule
+func (s *Scheduler) Add(cmd *ScheduledCommand) error {
+	if err := cmd.check(); err != nil {
+		return err
+	}
+	if cmd.ID == "" {
+		b := make([]byte, 8)
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+		cmd.ID = hex.EncodeToString(b)
+	}
+	if cmd.Created.IsZero() {
+		cmd.Created = time.Now()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.commands {
+		if existing.ID == cmd.ID {
+			return fmt.Errorf("command %q is already scheduled", cmd.ID)
+		}
+	}
+	s.commands = append(s.commands, cmd)
+	return s.save()
+}
+
+// Remove unschedules the command with the given ID and saves the schedule
+func (s *Scheduler) Remove(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, cmd := range s.commands {
+		if cmd.ID == id {
+			s.commands = append(s.commands[:i], s.commands[i+1:]...)
+			return s.save()
+		}
+	}
+	return fmt.Errorf("no command scheduled with id %q", id)
+}
+
+// Commands returns copies of the scheduled commands
+func (s *Scheduler) Commands() []ScheduledCommand {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	commands := make([]ScheduledCommand, len(s.commands))
+	for i, cmd := range s.commands {
+		commands[i] = *cmd
+		commands[i].Outcomes = append([]*ScheduleOutcome(nil), cmd.Outcomes...)
+	}
+	return commands
+}
+
+// Start runs due commands at the start of every minute until the scheduler is
+// closed. Closing it cancels waiting for a vehicle to wake up.
+func (s *Scheduler) Start() {
+	s.startOnce.Do(func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-s.done
+			cancel()
+		}()
+		go func() {
+			defer close(s.stopped)
+			for {
+				// outcomes that fail to save are kept in memory and saved with the next ones
+				s.RunDue(ctx, time.Now())
+				now := time.Now()
+				select {
+				case <-s.done:
+					return
+				case <-time.After(now.Truncate(time.Minute).Add(time.Minute).Sub(now)):
+				}
+			}
+		}()
+	})
+}
+
+// Close stops the scheduler, waiting for any command being sent, if it was started
+func (s *Scheduler) Close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+	started := true
+	s.startOnce.Do(func() { started = false })
+	if started {
+		<-s.stopped
+	}
+}
+
+// RunDue runs every command whose schedule fired since it last ran, up to now,
+// and saves their outcomes. A command that missed several runs is run once.
+func (s *Scheduler) RunDue(ctx context.Context, now time.Time) ([]*ScheduleOutcome, error) {
+	type run struct {
+		cmd ScheduledCommand
+		due time.Time
+	}
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+	s.mu.Lock()
+	var runs []run
+	for _, cmd := range s.commands {
+		if due := cmd.due(now); !due.IsZero() {
+			runs = append(runs, run{cmd: *cmd, due: due})
+		}
+	}
+	s.mu.Unlock()
+	if len(runs) == 0 {
+		return nil, nil
+	}
+
+	outcomes := make([]*ScheduleOutcome, len(runs))
+	for i, r := range runs {
+		if now.Sub(r.due) > s.opts.MaxDelay {
+			outcomes[i] = &ScheduleOutcome{Due: r.due, Time: now, Skipped: true}
+			continue
+		}
+		outcomes[i] = s.run(ctx, &r.cmd)
+		outcomes[i].Due = r.due
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, r := range runs {
+		for _, cmd := range s.commands {
+			if cmd.ID != r.cmd.ID {
+				continue
+			}
+			lastRun := r.due
+			cmd.LastRun = &lastRun
+			cmd.Outcomes = append(cmd.Outcomes, outcomes[i])
+			if len(cmd.Outcomes) > scheduleHistoryLimit {
+				cmd.Outcomes = cmd.Outcomes[len(cmd.Outcomes)-scheduleHistoryLimit:]
+			}
+		}
+	}
+	return outcomes, s.save()
+}
+
+// run wakes the command's vehicle if needed and sends the command
+func (s *Scheduler) run(ctx context.Context, cmd *ScheduledCommand) *ScheduleOutcome {
+	outcome := &ScheduleOutcome{}
+	vehicle, woke, err := s.wake(ctx, cmd.Vehicle)
+	outcome.Woke = woke
+	if err == nil {
+		var response *CommandResponse
+		response, err = vehicle.Execute(ctx, cmd.Command, cmd.Args)
+		if err == nil {
+			outcome.Result = response.Response.Result
+			outcome.Reason = response.Response.Reason
+		}
+	}
+	if err != nil {
+		outcome.Error = err.Error()
+	}
+	outcome.Time = time.Now()
+	return outcome
+}
+
+// wake finds the vehicle and, unless it is online, wakes it up and waits for it
+// to come online. It reports whether the vehicle had to be woken.
+func (s *Scheduler) wake(ctx context.Context, name string) (*Vehicle, bool, error) {
+	vehicle, err := findVehicle(name)
+	if err != nil || vehicle.State == "online" {
+		return vehicle, false, err
+	}
+	if _, err = vehicle.Wakeup(); err != nil {
+		return nil, true, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.opts.WakeTimeout)
+	defer cancel()
+	ticker := time.NewTicker(s.opts.WakeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, true, fmt.Errorf("vehicle %q did not wake up: %v", name, ctx.Err())
+		case <-ticker.C:
+		}
+		if vehicle, err = findVehicle(name); err != nil {
+			return nil, true, err
+		}
+		if vehicle.State == "online" {
+			return vehicle, true, nil
+		}
+	}
+}
+
+// save writes the scheduled commands to a temporary file that replaces the
+// scheduler's file, so a crash never leaves it partly written
+func (s *Scheduler) save() error {
+	data, err := json.MarshalIndent(&schedulerFile{Commands: s.commands}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// check validates the command and its arguments, and parses its schedule
+func (c *ScheduledCommand) check() error {
+	if c.Vehicle == "" {
+		return errors.New("scheduled command has no vehicle")
+	}
+	schedule, err := ParseSchedule(c.Schedule)
+	if err != nil {
+		return err
+	}
+	c.schedule = schedule
+	c.location = time.Local
+	if c.TimeZone != "" {
+		if c.location, err = time.LoadLocation(c.TimeZone); err != nil {
+			return err
+		}
+	}
+	cmd, ok := LookupCommand(c.Command)
+	if !ok {
+		return fmt.Errorf("unknown command %q", c.Command)
+	}
+	_, err = cmd.decode(c.Args)
+	return err
+}
+
+// due returns the latest time the schedule fired since the command last ran, or
+// since it was created, up to now. It returns the zero time if it has not fired.
+func (c *ScheduledCommand) due(now time.Time) time.Time {
+	from := c.Created
+	if c.LastRun != nil {
+		from = *c.LastRun
+	}
+	var due time.Time
+	for next := c.schedule.Next(from.In(c.location)); !next.IsZero() && !next.After(now); next = c.schedule.Next(next) {
+		due = next
+	}
+	return due
+}
+
+// findVehicle looks the vehicle up by ID, VIN or display name in the account's vehicle list
+func findVehicle(name string) (*Vehicle, error) {
+	vehicles, err := ActiveClient.Vehicles()
+	if err != nil {
+		return nil, err
+	}
+	for _, vehicle := range vehicles {
+		if vehicle.identifiedBy(name) {
+			return vehicle.Vehicle, nil
+		}
+	}
+	return nil, fmt.Errorf("vehicle %q not found", name)
+}
@@ -0,0 +1,166 @@
+package tesla
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheduler(t *testing.T) {
+	var mu sync.Mutex
+	state := "asleep"
+	var sent []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch req.URL.Path {
+		case "/oauth/token":
+			w.Write([]byte(`{"access_token": "sometoken123"}`))
+		case "/api/1/vehicles":
+			w.Write([]byte(strings.Replace(VehiclesJSON, `"state":"online"`, `"state":"`+state+`"`, 1)))
+		case "/api/1/vehicles/123/wake_up":
+			state = "online"
+			w.Write([]byte(WakeupResponseJSON))
+		case "/api/1/vehicles/123/command/auto_conditioning_start",
+			"/api/1/vehicles/123/command/set_charge_limit":
+			sent = append(sent, req.URL.Path[strings.LastIndex(req.URL.Path, "/")+1:])
+			w.Write([]byte(CommandResponseJSON))
+		}
+	}))
+	defer ts.Close()
+	previousURL := BaseURL
+	BaseURL = ts.URL + "/api/1"
+	defer func() { BaseURL = previousURL }()
+
+	auth := &Auth{
+		GrantType:    "password",
+		ClientID:     "someclient123",
+		ClientSecret: "somesecret456",
+		Email:        "nobody@example.com",
+		Password:     "pass",
+	}
+	NewClient(auth)
+
+	path := filepath.Join(os.TempDir(), "tesla-schedule.json")
+	os.Remove(path)
+	defer os.Remove(path)
+	scheduler, err := NewScheduler(path, &SchedulerOptions{WakeInterval: time.Millisecond})
+	assert.Nil(t, err)
+	// Monday 18 April 2016
+	monday := time.Date(2016, 4, 18, 7, 0, 0, 0, time.UTC)
+
+	assert.NotNil(t, scheduler.Add(&ScheduledCommand{Vehicle: "Otto", Schedule: "40 7 * * *", Command: "self_destruct"}))
+	assert.NotNil(t, scheduler.Add(&ScheduledCommand{Vehicle: "Otto", Schedule: "40 7 * * *", Command: "set_charge_limit", Args: map[string]interface{}{"level": 50}}))
+	precondition := &ScheduledCommand{Vehicle: "Otto", Schedule: "40 7 * * mon-fri", TimeZone: "UTC", Command: "auto_conditioning_start", Created: monday}
+	assert.Nil(t, scheduler.Add(precondition))
+	assert.NotEmpty(t, precondition.ID)
+	assert.Nil(t, scheduler.Add(&ScheduledCommand{ID: "limit", Vehicle: "abc123", Schedule: "0 22 * * *", TimeZone: "UTC", Command: "set_charge_limit", Args: map[string]interface{}{"percent": 50}, Created: monday}))
+	assert.NotNil(t, scheduler.Add(&ScheduledCommand{ID: "limit", Vehicle: "abc123", Schedule: "0 22 * * *", Command: "charge_start"}))
+
+	ctx := context.Background()
+	outcomes, err := scheduler.RunDue(ctx, monday.Add(30*time.Minute))
+	assert.Nil(t, err)
+	assert.Empty(t, outcomes)
+
+	// the vehicle is woken up before the command is sent
+	outcomes, err = scheduler.RunDue(ctx, monday.Add(41*time.Minute))
+	assert.Nil(t, err)
+	if assert.Len(t, outcomes, 1) {
+		assert.True(t, outcomes[0].Woke)
+		assert.True(t, outcomes[0].Result)
+		assert.Empty(t, outcomes[0].Error)
+		assert.Equal(t, monday.Add(40*time.Minute), outcomes[0].Due)
+	}
+	assert.Equal(t, []string{"auto_conditioning_start"}, sent)
+	outcomes, _ = scheduler.RunDue(ctx, monday.Add(42*time.Minute))
+	assert.Empty(t, outcomes)
+
+	// schedules and outcomes survive a restart; runs missed by too much are skipped
+	scheduler, err = NewScheduler(path, nil)
+	assert.Nil(t, err)
+	commands := scheduler.Commands()
+	assert.Len(t, commands, 2)
+	assert.Equal(t, monday.Add(40*time.Minute), commands[0].LastRun.UTC())
+	assert.Len(t, commands[0].Outcomes, 1)
+
+	outcomes, err = scheduler.RunDue(ctx, time.Date(2016, 4, 19, 7, 43, 0, 0, time.UTC))
+	assert.Nil(t, err)
+	if assert.Len(t, outcomes, 2) {
+		assert.False(t, outcomes[0].Skipped)
+		assert.False(t, outcomes[0].Woke)
+		assert.True(t, outcomes[1].Skipped)
+		assert.Equal(t, time.Date(2016, 4, 18, 22, 0, 0, 0, time.UTC), outcomes[1].Due.UTC())
+	}
+	assert.Equal(t, []string{"auto_conditioning_start", "auto_conditioning_start"}, sent)
+
+	assert.Nil(t, scheduler.Remove("limit"))
+	assert.NotNil(t, scheduler.Remove("limit"))
+	scheduler, _ = NewScheduler(path, nil)
+	assert.Len(t, scheduler.Commands(), 1)
+	scheduler.Close()
+}
+
+func TestSchedulerClose(t *testing.T) {
+	woken := make(chan struct{}, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/oauth/token":
+			w.Write([]byte(`{"access_token": "sometoken123"}`))
+		case "/api/1/vehicles":
+			w.Write([]byte(strings.Replace(VehiclesJSON, `"state":"online"`, `"state":"asleep"`, 1)))
+		case "/api/1/vehicles/123/wake_up":
+			// the vehicle never wakes up
+			select {
+			case woken <- struct{}{}:
+			default:
+			}
+			w.Write([]byte(WakeupResponseJSON))
+		}
+	}))
+	defer ts.Close()
+	previousURL := BaseURL
+	BaseURL = ts.URL + "/api/1"
+	defer func() { BaseURL = previousURL }()
+
+	auth := &Auth{
+		GrantType:    "password",
+		ClientID:     "someclient123",
+		ClientSecret: "somesecret456",
+		Email:        "nobody@example.com",
+		Password:     "pass",
+	}
+	NewClient(auth)
+
+	path := filepath.Join(os.TempDir(), "tesla-schedule-close.json")
+	os.Remove(path)
+	defer os.Remove(path)
+	scheduler, err := NewScheduler(path, &SchedulerOptions{WakeTimeout: time.Hour, WakeInterval: time.Millisecond})
+	assert.Nil(t, err)
+	assert.Nil(t, scheduler.Add(&ScheduledCommand{Vehicle: "Otto", Schedule: "* * * * *", Command: "door_lock", Created: time.Now().Add(-2 * time.Minute)}))
+
+	// closing stops waiting for the vehicle to wake up
+	scheduler.Start()
+	select {
+	case <-woken:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the scheduled run")
+	}
+	closed := make(chan struct{})
+	go func() {
+		scheduler.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("close waited for the vehicle to wake up")
+	}
+}
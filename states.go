@@ -123,6 +123,8 @@ type VehicleState struct {
 	RoofColor               string  `json:"roof_color"`
 	Rt                      int     `json:"rt"`
 	SeatType                int     `json:"seat_type"`
+	SentryMode              bool    `json:"sentry_mode"`
+	SentryModeAvailable     bool    `json:"sentry_mode_available"`
 	SpoilerType             string  `json:"spoiler_type"`
 	SunRoofInstalled        int     `json:"sun_roof_installed"`
 	SunRoofPercentOpen      int     `json:"sun_roof_percent_open"`
@@ -144,6 +146,20 @@ type StateResponse struct {
 	} `json:"response"`
 }
 
+// VehicleData holds the states of a vehicle read in a single request
+type VehicleData struct {
+	ChargeState  *ChargeState  `json:"charge_state"`
+	ClimateState *ClimateState `json:"climate_state"`
+	DriveState   *DriveState   `json:"drive_state"`
+	GuiSettings  *GuiSettings  `json:"gui_settings"`
+	VehicleState *VehicleState `json:"vehicle_state"`
+}
+
+// VehicleDataResponse is the response received when requesting all of a vehicle's states
+type VehicleDataResponse struct {
+	Response *VehicleData `json:"response"`
+}
+
 // BoolStateResponse is the response when a state is requested for a simple boolean state
 type BoolStateResponse struct {
 	Bool bool `json:"response"`
@@ -208,6 +224,20 @@ func (v Vehicle) VehicleState() (*VehicleState, error) {
 	return state.Response.VehicleState, nil
 }
 
+// Data returns all of the vehicle's states with a single request
+func (v Vehicle) Data() (*VehicleData, error) {
+	body, err := ActiveClient.get(BaseURL + "/vehicles/" + strconv.FormatInt(v.ID, 10) + "/vehicle_data")
+	if err != nil {
+		return nil, err
+	}
+	response := &VehicleDataResponse{}
+	err = json.Unmarshal(body, response)
+	if err != nil {
+		return nil, err
+	}
+	return response.Response, nil
+}
+
 func fetchState(resource string, id int64) (*StateResponse, error) {
 	state := &StateResponse{}
 	body, err := ActiveClient.get(BaseURL + "/vehicles/" + strconv.FormatInt(id, 10) + "/data_request" + resource)
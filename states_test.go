@@ -55,5 +55,13 @@ func TestStates(t *testing.T) {
 	assert.True(t, vehicleState.CalendarSupported)
 	assert.Equal(t, 0, vehicleState.Rt)
 
+	data, err := vehicle.Data()
+	assert.Nil(t, err)
+	assert.Equal(t, 90, data.ChargeState.BatteryLevel)
+	assert.False(t, data.ClimateState.IsClimateOn)
+	assert.Equal(t, 3.6, data.DriveState.Latitude)
+	assert.Equal(t, "mi/hr", data.GuiSettings.GuiDistanceUnits)
+	assert.True(t, data.VehicleState.SentryMode)
+
 	BaseURL = previousURL
 }
@@ -3,84 +3,287 @@ package tesla
 import (
 	"bufio"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 )
 
-// StreamEvent of a vehicle returned by the Tesla API
+// StreamEvent of a vehicle returned by the Tesla API. Fields are nil when the
+// stream did not include a value for them, or the value could not be parsed.
 type StreamEvent struct {
-	Elevation  int       `json:"elevation"`
-	EstHeading int       `json:"est_heading"`
-	EstLat     float64   `json:"est_lat"`
-	EstLng     float64   `json:"est_lng"`
-	EstRange   int       `json:"est_range"`
-	Heading    int       `json:"heading"`
-	Odometer   float64   `json:"odometer"`
-	Power      int       `json:"power"`
-	Range      int       `json:"range"`
-	ShiftState string    `json:"shift_state"`
-	Soc        int       `json:"soc"`
-	Speed      int       `json:"speed"`
+	Elevation  *int      `json:"elevation"`
+	EstHeading *int      `json:"est_heading"`
+	EstLat     *float64  `json:"est_lat"`
+	EstLng     *float64  `json:"est_lng"`
+	EstRange   *int      `json:"est_range"`
+	Heading    *int      `json:"heading"`
+	Odometer   *float64  `json:"odometer"`
+	Power      *int      `json:"power"`
+	Range      *int      `json:"range"`
+	ShiftState *string   `json:"shift_state"`
+	Soc        *int      `json:"soc"`
+	Speed      *int      `json:"speed"`
 	Timestamp  time.Time `json:"timestamp"`
+	// Extra holds requested fields the StreamEvent has no field for and any
+	// columns beyond those requested, keyed by their column number
+	Extra map[string]string `json:"extra,omitempty"`
 }
 
-// Stream starts a stream from the vehicle in the form of a go channel
-func (v Vehicle) Stream() (chan *StreamEvent, chan error, error) {
-	url := StreamURL + "/stream/" + strconv.Itoa(v.VehicleID) + "/?values=" + StreamParams
-	req, _ := http.NewRequest("GET", url, nil)
-	req.SetBasicAuth(ActiveClient.Auth.Email, v.Tokens[0])
-	resp, err := ActiveClient.HTTP.Do(req)
+// StreamParseError describes a stream line that could not be parsed, either
+// entirely or for some of its fields
+type StreamParseError struct {
+	// Line is the raw line received from the stream
+	Line string
+	// Invalid maps each field whose value could not be parsed to that value;
+	// it is empty when the line as a whole was rejected
+	Invalid map[string]string
+}
+
+func (e *StreamParseError) Error() string {
+	if len(e.Invalid) == 0 {
+		return fmt.Sprintf("invalid message from tesla api stream: %q", e.Line)
+	}
+	fields := make([]string, 0, len(e.Invalid))
+	for field := range e.Invalid {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fmt.Sprintf("invalid values for %s in message from tesla api stream: %q", strings.Join(fields, ", "), e.Line)
+}
+
+// StreamStats counts what was received on a stream, including parse anomalies
+type StreamStats struct {
+	// Lines received from the stream
+	Lines int64
+	// Malformed lines that could not be parsed into an event
+	Malformed int64
+	// MissingValues are empty values, reported as nil fields
+	MissingValues int64
+	// InvalidValues are values that could not be parsed, reported as nil fields
+	InvalidValues int64
+}
 
+// record counts a line and the outcome of parsing it
+func (s *StreamStats) record(line string, fields []string, event *StreamEvent, err error) {
+	s.Lines++
+	if event == nil {
+		s.Malformed++
+		return
+	}
+	var parseErr *StreamParseError
+	if errors.As(err, &parseErr) {
+		s.InvalidValues += int64(len(parseErr.Invalid))
+	}
+	for i, value := range strings.Split(line, ",")[1:] {
+		if i >= len(fields) {
+			break
+		}
+		if _, ok := streamFieldSetters[fields[i]]; ok && value == "" {
+			s.MissingValues++
+		}
+	}
+}
+
+// streamFieldSetters assign a stream column's value to the matching StreamEvent
+// field, leaving it nil when the value is empty
+var streamFieldSetters = map[string]func(e *StreamEvent, value string) error{
+	"elevation":   func(e *StreamEvent, value string) (err error) { e.Elevation, err = parseStreamInt(value); return },
+	"est_heading": func(e *StreamEvent, value string) (err error) { e.EstHeading, err = parseStreamInt(value); return },
+	"est_lat":     func(e *StreamEvent, value string) (err error) { e.EstLat, err = parseStreamFloat(value); return },
+	"est_lng":     func(e *StreamEvent, value string) (err error) { e.EstLng, err = parseStreamFloat(value); return },
+	"est_range":   func(e *StreamEvent, value string) (err error) { e.EstRange, err = parseStreamInt(value); return },
+	"heading":     func(e *StreamEvent, value string) (err error) { e.Heading, err = parseStreamInt(value); return },
+	"odometer":    func(e *StreamEvent, value string) (err error) { e.Odometer, err = parseStreamFloat(value); return },
+	"power":       func(e *StreamEvent, value string) (err error) { e.Power, err = parseStreamInt(value); return },
+	"range":       func(e *StreamEvent, value string) (err error) { e.Range, err = parseStreamInt(value); return },
+	"shift_state": func(e *StreamEvent, value string) error {
+		if value != "" {
+			e.ShiftState = &value
+		}
+		return nil
+	},
+	"soc":   func(e *StreamEvent, value string) (err error) { e.Soc, err = parseStreamInt(value); return },
+	"speed": func(e *StreamEvent, value string) (err error) { e.Speed, err = parseStreamInt(value); return },
+}
+
+func parseStreamInt(value string) (*int, error) {
+	if value == "" {
+		return nil, nil
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+func parseStreamFloat(value string) (*float64, error) {
+	if value == "" {
+		return nil, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// streamFields returns the given fields, or the fields in StreamParams when none are given
+func streamFields(fields []string) []string {
+	if len(fields) == 0 {
+		return strings.Split(StreamParams, ",")
+	}
+	return fields
+}
+
+// ErrStreamUnauthorized is returned when the streaming API rejects the vehicle's stream token
+var ErrStreamUnauthorized = errors.New("stream unauthorized")
+
+// streamConn is a connection to the Tesla streaming API that yields raw event lines
+type streamConn interface {
+	ReadLine() (string, error)
+	Close() error
+}
+
+// httpStreamConn reads events from the HTTP streaming endpoint
+type httpStreamConn struct {
+	body    io.ReadCloser
+	scanner *bufio.Scanner
+}
+
+// ReadLine returns the next line of the stream, or an error once the stream is closed
+func (c *httpStreamConn) ReadLine() (string, error) {
+	if c.scanner.Scan() {
+		return c.scanner.Text(), nil
+	}
+	if err := c.scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", errors.New("http stream closed")
+}
+
+// Close closes the HTTP response body
+func (c *httpStreamConn) Close() error {
+	return c.body.Close()
+}
+
+// Stream starts a stream from the vehicle in the form of a go channel. Events
+// contain the given fields, or those in StreamParams when none are given. The
+// event channel is closed once the stream ends, after the error ending it is sent.
+func (v Vehicle) Stream(fields ...string) (chan *StreamEvent, chan error, error) {
+	fields = streamFields(fields)
+	conn, err := v.dialHTTPStream(fields)
 	if err != nil {
 		return nil, nil, err
 	}
 
 	eventChan := make(chan *StreamEvent)
-	errChan := make(chan error)
-	go readStream(resp, eventChan, errChan)
+	errChan := make(chan error, 1)
+	go readStream(conn, fields, eventChan, errChan)
 
 	return eventChan, errChan, nil
 }
 
-func readStream(resp *http.Response, eventChan chan *StreamEvent, errChan chan error) {
-	reader := bufio.NewReader(resp.Body)
-	scanner := bufio.NewScanner(reader)
+// dialHTTPStream opens the HTTP streaming endpoint for the fields with the vehicle's first token
+func (v Vehicle) dialHTTPStream(fields []string) (*httpStreamConn, error) {
+	if len(v.Tokens) == 0 {
+		return nil, ErrStreamUnauthorized
+	}
+	url := StreamURL + "/stream/" + strconv.Itoa(v.VehicleID) + "/?values=" + strings.Join(fields, ",")
+	req, _ := http.NewRequest("GET", url, nil)
+	req.SetBasicAuth(ActiveClient.Auth.Email, v.Tokens[0])
+	resp, err := ActiveClient.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusUnauthorized {
+			return nil, ErrStreamUnauthorized
+		}
+		return nil, errors.New(resp.Status)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
 	scanner.Split(bufio.ScanLines)
-	defer resp.Body.Close()
+	return &httpStreamConn{body: resp.Body, scanner: scanner}, nil
+}
 
-	for scanner.Scan() {
-		streamEvent, err := parseStreamEvent(scanner.Text())
-		if err == nil {
-			eventChan <- streamEvent
-		} else {
+// readStream sends events and parse errors until the connection ends, then
+// closes eventChan. Parse errors are dropped while an earlier error is still
+// unread, so only reading eventChan keeps the stream going. The error ending the
+// stream is always sent, replacing any unread parse error.
+func readStream(conn streamConn, fields []string, eventChan chan *StreamEvent, errChan chan error) {
+	defer conn.Close()
+	defer close(eventChan)
+
+	for {
+		line, err := conn.ReadLine()
+		if err != nil {
+			select {
+			case <-errChan:
+			default:
+			}
 			errChan <- err
+			return
+		}
+		streamEvent, err := parseStreamEvent(line, fields)
+		if err != nil {
+			select {
+			case errChan <- err:
+			default:
+			}
+		}
+		if streamEvent != nil {
+			eventChan <- streamEvent
 		}
 	}
-	errChan <- errors.New("http stream closed")
 }
 
-func parseStreamEvent(event string) (*StreamEvent, error) {
+// parseStreamEvent parses a line of comma separated values: the timestamp
+// followed by a column for each of the requested fields, in order. Lines with
+// too few columns or an invalid timestamp return only an error; lines with
+// invalid field values return the event along with a *StreamParseError.
+func parseStreamEvent(event string, fields []string) (*StreamEvent, error) {
 	data := strings.Split(event, ",")
-	if len(data) != 13 {
-		return nil, errors.New("invalid message from tesla api stream")
+	if len(data) < len(fields)+1 {
+		return nil, &StreamParseError{Line: event}
+	}
+	timestamp, err := strconv.ParseInt(data[0], 10, 64)
+	if err != nil {
+		return nil, &StreamParseError{Line: event}
 	}
 
 	streamEvent := &StreamEvent{}
-	timestamp, _ := strconv.ParseInt(data[0], 10, 64)
 	streamEvent.Timestamp = time.Unix(0, timestamp*int64(time.Millisecond))
-	streamEvent.Speed, _ = strconv.Atoi(data[1])
-	streamEvent.Odometer, _ = strconv.ParseFloat(data[2], 64)
-	streamEvent.Soc, _ = strconv.Atoi(data[3])
-	streamEvent.Elevation, _ = strconv.Atoi(data[4])
-	streamEvent.EstHeading, _ = strconv.Atoi(data[5])
-	streamEvent.EstLat, _ = strconv.ParseFloat(data[6], 64)
-	streamEvent.EstLng, _ = strconv.ParseFloat(data[7], 64)
-	streamEvent.Power, _ = strconv.Atoi(data[8])
-	streamEvent.ShiftState = data[9]
-	streamEvent.Range, _ = strconv.Atoi(data[10])
-	streamEvent.EstRange, _ = strconv.Atoi(data[11])
-	streamEvent.Heading, _ = strconv.Atoi(data[12])
+	invalid := map[string]string{}
+	for i, value := range data[1:] {
+		if i >= len(fields) {
+			streamEvent.setExtra(strconv.Itoa(i+1), value)
+			continue
+		}
+		set, ok := streamFieldSetters[fields[i]]
+		if !ok {
+			streamEvent.setExtra(fields[i], value)
+			continue
+		}
+		if err := set(streamEvent, value); err != nil {
+			invalid[fields[i]] = value
+		}
+	}
+	if len(invalid) > 0 {
+		return streamEvent, &StreamParseError{Line: event, Invalid: invalid}
+	}
 	return streamEvent, nil
 }
+
+func (e *StreamEvent) setExtra(key string, value string) {
+	if e.Extra == nil {
+		e.Extra = map[string]string{}
+	}
+	e.Extra[key] = value
+}
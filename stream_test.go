@@ -1,7 +1,9 @@
 package tesla
 
 import (
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -23,13 +25,15 @@ func TestStreamSpec(t *testing.T) {
 
 	select {
 	case event := <-eventChan:
-		assert.Equal(t, 65, event.Speed)
+		assert.Equal(t, 65, *event.Speed)
+		assert.Nil(t, event.Power)
+		assert.Nil(t, event.ShiftState)
 	case err = <-errChan:
 		assert.Nil(t, err)
 	}
 	select {
 	case event := <-eventChan:
-		assert.Equal(t, 65, event.Speed)
+		assert.Equal(t, 65, *event.Speed)
 	case err = <-errChan:
 		assert.Nil(t, err)
 	}
@@ -37,7 +41,7 @@ func TestStreamSpec(t *testing.T) {
 	case event := <-eventChan:
 		assert.Nil(t, event)
 	case err = <-errChan:
-		assert.Equal(t, "invalid message from tesla api stream", err.Error())
+		assert.Equal(t, "invalid message from tesla api stream: \""+BadStreamEventString+"\"", err.Error())
 	}
 	select {
 	case event := <-eventChan:
@@ -49,3 +53,106 @@ func TestStreamSpec(t *testing.T) {
 	BaseURL = previousURL
 	StreamURL = previousStreamURL
 }
+
+func TestStreamFields(t *testing.T) {
+	ts := serveHTTP(t)
+	defer ts.Close()
+	vehicle := &Vehicle{}
+	vehicle.VehicleID = 123
+	vehicle.Tokens = []string{"456", "789"}
+
+	previousStreamURL := StreamURL
+	StreamURL = ts.URL
+
+	eventChan, _, err := vehicle.Stream("soc", "speed", "brake_temp")
+	assert.Nil(t, err)
+	event := <-eventChan
+	assert.Equal(t, 88, *event.Soc)
+	assert.Equal(t, 65, *event.Speed)
+	assert.Nil(t, event.Power)
+	assert.Equal(t, map[string]string{"brake_temp": "41", "4": "extra"}, event.Extra)
+
+	event, err = parseStreamEvent("1460905367000,D,12", []string{"shift_state", "power"})
+	assert.Nil(t, err)
+	assert.Equal(t, "D", *event.ShiftState)
+	assert.Equal(t, 12, *event.Power)
+	assert.Nil(t, event.Extra)
+	assert.Equal(t, int64(1460905367000), event.Timestamp.UnixNano()/int64(time.Millisecond))
+
+	_, err = parseStreamEvent("1460905367000,D", []string{"shift_state", "power"})
+	assert.Equal(t, "invalid message from tesla api stream: \"1460905367000,D\"", err.Error())
+
+	StreamURL = previousStreamURL
+}
+
+func TestStreamParseErrors(t *testing.T) {
+	fields := []string{"speed", "power", "shift_state", "soc"}
+	stats := &StreamStats{}
+
+	line := "1460905367000,,-12,,x"
+	event, err := parseStreamEvent(line, fields)
+	stats.record(line, fields, event, err)
+	assert.Nil(t, event.Speed)
+	assert.Equal(t, -12, *event.Power)
+	assert.Nil(t, event.ShiftState)
+	assert.Nil(t, event.Soc)
+	parseErr, ok := err.(*StreamParseError)
+	assert.True(t, ok)
+	assert.Equal(t, line, parseErr.Line)
+	assert.Equal(t, map[string]string{"soc": "x"}, parseErr.Invalid)
+	assert.Equal(t, `invalid values for soc in message from tesla api stream: "1460905367000,,-12,,x"`, err.Error())
+
+	line = "yesterday,0,0,P,80"
+	event, err = parseStreamEvent(line, fields)
+	stats.record(line, fields, event, err)
+	assert.Nil(t, event)
+	assert.Equal(t, line, err.(*StreamParseError).Line)
+
+	line = "1460905368000,0,0,P,80"
+	event, err = parseStreamEvent(line, fields)
+	stats.record(line, fields, event, err)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, *event.Speed)
+
+	assert.Equal(t, StreamStats{Lines: 3, Malformed: 1, MissingValues: 2, InvalidValues: 1}, *stats)
+}
+
+// lineConn yields fixed lines, then an error
+type lineConn struct {
+	lines []string
+}
+
+func (c *lineConn) ReadLine() (string, error) {
+	if len(c.lines) == 0 {
+		return "", errors.New("stream ended")
+	}
+	line := c.lines[0]
+	c.lines = c.lines[1:]
+	return line, nil
+}
+
+func (c *lineConn) Close() error {
+	return nil
+}
+
+func TestReadStreamUnreadErrors(t *testing.T) {
+	fields := []string{"speed", "power", "shift_state", "soc"}
+	conn := &lineConn{lines: []string{"bad", "worse", "1460905367000,10,5,D,80", "worst", "1460905368000,20,5,D,79"}}
+	eventChan := make(chan *StreamEvent)
+	errChan := make(chan error, 1)
+	go readStream(conn, fields, eventChan, errChan)
+
+	// only events are read; parse errors beyond the buffered one are dropped
+	for _, speed := range []int{10, 20} {
+		select {
+		case event := <-eventChan:
+			assert.Equal(t, speed, *event.Speed)
+		case <-time.After(time.Second):
+			t.Fatal("stream stalled on unread errors")
+		}
+	}
+	// the error ending the stream replaces the unread parse error
+	_, ok := <-eventChan
+	assert.False(t, ok)
+	assert.EqualError(t, <-errChan, "stream ended")
+}
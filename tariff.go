@@ -0,0 +1,259 @@
+package tesla
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"time"
+)
+
+// Tariff prices electricity per kWh. The price at a given time is that of the
+// first matching period of the season containing the date, the season's price
+// if no period matches, or Flat outside of every season. A tariff with only
+// Flat set is a flat rate.
+type Tariff struct {
+	Name string `json:"name"`
+	// Flat is the price per kWh outside of every season and period
+	Flat    float64        `json:"flat"`
+	Seasons []TariffSeason `json:"seasons,omitempty"`
+	// TimeZone seasons and periods are evaluated in; defaults to the local time zone
+	TimeZone string `json:"time_zone,omitempty"`
+	// DemandCharge is the price per kW of the highest average power drawn over
+	// any DemandMinutes long interval of a session
+	DemandCharge  float64 `json:"demand_charge,omitempty"`
+	DemandMinutes int     `json:"demand_minutes,omitempty"`
+	// SuperchargerPrice, when set, is the price per kWh added at fast chargers,
+	// which are billed for the energy added without demand charges
+	SuperchargerPrice float64 `json:"supercharger_price,omitempty"`
+
+	location *time.Location
+}
+
+// TariffSeason is a part of the year between two "01-02" month and day dates,
+// inclusive. Seasons where End is before Start span the new year.
+type TariffSeason struct {
+	Name    string         `json:"name"`
+	Start   string         `json:"start"`
+	End     string         `json:"end"`
+	Price   float64        `json:"price"`
+	Periods []TariffPeriod `json:"periods,omitempty"`
+}
+
+// TariffPeriod is a time of use period within a season, such as weekday peak
+// hours. Its time zone, if set, is ignored in favour of the tariff's.
+type TariffPeriod struct {
+	Name  string  `json:"name"`
+	Price float64 `json:"price"`
+	TimeWindow
+}
+
+// ChargeCost is the price of a charging session
+type ChargeCost struct {
+	// Energy is the kWh priced
+	Energy     float64 `json:"energy"`
+	EnergyCost float64 `json:"energy_cost"`
+	// PeakDemand is the highest average power in kW drawn over the tariff's demand interval
+	PeakDemand float64 `json:"peak_demand"`
+	DemandCost float64 `json:"demand_cost"`
+	Total      float64 `json:"total"`
+	// ByPeriod is the energy cost of each period, keyed by the season and period
+	// names joined with a slash, or "flat" outside of every season
+	ByPeriod map[string]float64 `json:"by_period"`
+}
+
+var defaultDemandMinutes = 15
+
+// LoadTariff reads a JSON tariff from the file at the given path
+func LoadTariff(path string) (*Tariff, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tariff := &Tariff{}
+	if err = json.Unmarshal(data, tariff); err != nil {
+		return nil, err
+	}
+	if err = tariff.check(); err != nil {
+		return nil, err
+	}
+	if tariff.location, err = tariff.zone(); err != nil {
+		return nil, err
+	}
+	return tariff, nil
+}
+
+// check validates the tariff's time zone, seasons and periods
+func (t *Tariff) check() error {
+	if _, err := t.zone(); err != nil {
+		return err
+	}
+	for _, season := range t.Seasons {
+		if _, err := time.Parse("01-02", season.Start); err != nil {
+			return fmt.Errorf("tariff season %q has invalid start %q", season.Name, season.Start)
+		}
+		if _, err := time.Parse("01-02", season.End); err != nil {
+			return fmt.Errorf("tariff season %q has invalid end %q", season.Name, season.End)
+		}
+		for _, period := range season.Periods {
+			if err := period.window().validate(); err != nil {
+				return fmt.Errorf("tariff period %q: %v", period.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// zone returns the time zone the tariff is evaluated in. Tariffs read by
+// LoadTariff have it loaded already; it is never stored here, so tariffs may be
+// shared between goroutines.
+func (t *Tariff) zone() (*time.Location, error) {
+	if t.location != nil {
+		return t.location, nil
+	}
+	if t.TimeZone == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(t.TimeZone)
+}
+
+// Price returns the price per kWh at the given time
+func (t *Tariff) Price(at time.Time) (float64, error) {
+	location, err := t.zone()
+	if err != nil {
+		return 0, err
+	}
+	price, _ := t.price(at.In(location))
+	return price, nil
+}
+
+// price returns the price per kWh at the given time, in the tariff's time zone,
+// and the name of the period it comes from
+func (t *Tariff) price(at time.Time) (float64, string) {
+	day := at.Format("01-02")
+	for _, season := range t.Seasons {
+		inside := season.Start <= day && day <= season.End
+		if season.End < season.Start {
+			inside = day >= season.Start || day <= season.End
+		}
+		if !inside {
+			continue
+		}
+		for _, period := range season.Periods {
+			if period.window().contains(at) {
+				return period.Price, season.Name + "/" + period.Name
+			}
+		}
+		return season.Price, season.Name
+	}
+	return t.Flat, "flat"
+}
+
+// Cost prices a charging session. Sessions at fast chargers are priced at the
+// supercharger price for the energy added, when one is set. Other sessions are
+// priced minute by minute from the power drawn between samples, plus the demand
+// charge; sessions with fewer than two samples are priced for the energy added
+// at the price when they started.
+func (t *Tariff) Cost(session *ChargingSession) (*ChargeCost, error) {
+	cost := &ChargeCost{ByPeriod: map[string]float64{}}
+	if session.FastCharger && t.SuperchargerPrice > 0 {
+		cost.Energy = session.EnergyAdded
+		cost.EnergyCost = session.EnergyAdded * t.SuperchargerPrice
+		cost.ByPeriod["supercharger"] = cost.EnergyCost
+		cost.Total = cost.EnergyCost
+		return cost, nil
+	}
+	location, err := t.zone()
+	if err != nil {
+		return nil, err
+	}
+	if len(session.Samples) < 2 {
+		price, name := t.price(session.Start.In(location))
+		cost.Energy = session.EnergyAdded
+		cost.EnergyCost = session.EnergyAdded * price
+		cost.ByPeriod[name] = cost.EnergyCost
+		cost.Total = cost.EnergyCost
+		return cost, nil
+	}
+
+	// the energy drawn in each minute, interpolating power linearly between samples
+	var minutes []float64
+	for i := 1; i < len(session.Samples); i++ {
+		from, to := session.Samples[i-1], session.Samples[i]
+		span := to.Time.Sub(from.Time)
+		for start := time.Duration(0); start < span; start += time.Minute {
+			end := start + time.Minute
+			if end > span {
+				end = span
+			}
+			middle := float64(start+end) / 2 / float64(span)
+			power := from.Power + (to.Power-from.Power)*middle
+			energy := power * (end - start).Hours()
+			price, name := t.price(from.Time.Add(start).In(location))
+			cost.Energy += energy
+			cost.EnergyCost += energy * price
+			cost.ByPeriod[name] += energy * price
+			minutes = append(minutes, energy)
+		}
+	}
+
+	if t.DemandCharge > 0 {
+		interval := t.DemandMinutes
+		if interval <= 0 {
+			interval = defaultDemandMinutes
+		}
+		var window float64
+		for i, energy := range minutes {
+			window += energy
+			if i >= interval {
+				window -= minutes[i-interval]
+			}
+			cost.PeakDemand = math.Max(cost.PeakDemand, window*60/float64(interval))
+		}
+		cost.DemandCost = cost.PeakDemand * t.DemandCharge
+	}
+	cost.Total = cost.EnergyCost + cost.DemandCost
+	return cost, nil
+}
+
+// CheapestWindow returns the start of the cheapest period of the given duration
+// between from and until, to the minute, and its average price per kWh. Use the
+// energy needed divided by the charging power as the duration.
+func (t *Tariff) CheapestWindow(from, until time.Time, duration time.Duration) (time.Time, float64, error) {
+	from = from.Truncate(time.Minute)
+	length := int(duration / time.Minute)
+	total := int(until.Sub(from) / time.Minute)
+	if length <= 0 || length > total {
+		return time.Time{}, 0, errors.New("charging duration does not fit between the given times")
+	}
+
+	location, err := t.zone()
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	prices := make([]float64, total)
+	for i := range prices {
+		prices[i], _ = t.price(from.Add(time.Duration(i) * time.Minute).In(location))
+	}
+	var sum float64
+	for _, price := range prices[:length] {
+		sum += price
+	}
+	best, bestSum := 0, sum
+	for i := length; i < total; i++ {
+		sum += prices[i] - prices[i-length]
+		// only strictly cheaper windows move the start, so ties charge earlier
+		if sum < bestSum-1e-9 {
+			best, bestSum = i-length+1, sum
+		}
+	}
+	return from.Add(time.Duration(best) * time.Minute), bestSum / float64(length), nil
+}
+
+// window returns the period's time window without its own time zone
+func (p TariffPeriod) window() TimeWindow {
+	w := p.TimeWindow
+	w.TimeZone = ""
+	return w
+}
@@ -0,0 +1,134 @@
+package tesla
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var TariffJSON = `{"name":"home","flat":0.12,"time_zone":"UTC","demand_charge":2,"seasons":[
+	{"name":"summer","start":"06-01","end":"09-30","price":0.20,"periods":[
+		{"name":"peak","price":0.40,"start":"16:00","end":"21:00","days":["mon","tue","wed","thu","fri"]},
+		{"name":"off-peak","price":0.10,"start":"00:00","end":"07:00"}
+	]},
+	{"name":"winter","start":"12-01","end":"02-28","price":0.15}
+]}`
+
+func TestTariff(t *testing.T) {
+	tariff, err := LoadTariff(writeTemp(t, TariffJSON))
+	assert.Nil(t, err)
+	assert.Len(t, tariff.Seasons, 2)
+
+	prices := map[time.Time]float64{
+		// Wednesday peak, Saturday at the same time, and overnight
+		time.Date(2020, 7, 1, 17, 0, 0, 0, time.UTC): 0.40,
+		time.Date(2020, 7, 4, 17, 0, 0, 0, time.UTC): 0.20,
+		time.Date(2020, 7, 1, 3, 0, 0, 0, time.UTC):  0.10,
+		// winter spans the new year, and spring is in no season
+		time.Date(2021, 1, 15, 17, 0, 0, 0, time.UTC): 0.15,
+		time.Date(2020, 4, 15, 17, 0, 0, 0, time.UTC): 0.12,
+	}
+	for at, expected := range prices {
+		price, err := tariff.Price(at)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, price, at.String())
+	}
+
+	_, err = LoadTariff(writeTemp(t, `{"seasons":[{"name":"summer","start":"June","end":"09-30"}]}`))
+	assert.EqualError(t, err, `tariff season "summer" has invalid start "June"`)
+
+	// tariffs built in code are read without being modified, so they may be shared
+	shared := &Tariff{Flat: 0.12, TimeZone: "UTC", Seasons: tariff.Seasons}
+	done := make(chan struct{})
+	for i := 0; i < 2; i++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			for at, expected := range prices {
+				price, err := shared.Price(at)
+				assert.Nil(t, err)
+				assert.Equal(t, expected, price, at.String())
+			}
+		}()
+	}
+	<-done
+	<-done
+	assert.Nil(t, shared.location)
+}
+
+func TestTariffCost(t *testing.T) {
+	tariff, err := LoadTariff(writeTemp(t, TariffJSON))
+	assert.Nil(t, err)
+
+	// half an hour either side of the start of peak hours at 10 kW
+	start := time.Date(2020, 7, 1, 15, 30, 0, 0, time.UTC)
+	session := &ChargingSession{Start: start, Samples: []ChargeSample{
+		{Time: start, Power: 10},
+		{Time: start.Add(time.Hour), Power: 10},
+	}}
+	cost, err := tariff.Cost(session)
+	assert.Nil(t, err)
+	assert.InDelta(t, 10, cost.Energy, 1e-9)
+	assert.InDelta(t, 3, cost.EnergyCost, 1e-9)
+	assert.InDelta(t, 1, cost.ByPeriod["summer"], 1e-9)
+	assert.InDelta(t, 2, cost.ByPeriod["summer/peak"], 1e-9)
+	assert.InDelta(t, 10, cost.PeakDemand, 1e-9)
+	assert.InDelta(t, 20, cost.DemandCost, 1e-9)
+	assert.InDelta(t, 23, cost.Total, 1e-9)
+
+	// power is interpolated between samples; the last 15 minutes average 10.5 kW
+	flat := &Tariff{Flat: 0.1, DemandCharge: 1}
+	session.Samples[0].Power = 0
+	session.Samples[1].Power = 12
+	cost, err = flat.Cost(session)
+	assert.Nil(t, err)
+	assert.InDelta(t, 6, cost.Energy, 1e-9)
+	assert.InDelta(t, 0.6, cost.EnergyCost, 1e-9)
+	assert.InDelta(t, 10.5, cost.PeakDemand, 1e-9)
+	assert.InDelta(t, 11.1, cost.Total, 1e-9)
+
+	// fast chargers bill the energy added
+	tariff.SuperchargerPrice = 0.3
+	cost, err = tariff.Cost(&ChargingSession{Start: start, FastCharger: true, EnergyAdded: 40, Samples: session.Samples})
+	assert.Nil(t, err)
+	assert.InDelta(t, 12, cost.Total, 1e-9)
+	assert.Equal(t, map[string]float64{"supercharger": 12}, cost.ByPeriod)
+
+	// a single sample is priced at the start of the session
+	cost, err = tariff.Cost(&ChargingSession{Start: start.Add(time.Hour), EnergyAdded: 5, Samples: session.Samples[:1]})
+	assert.Nil(t, err)
+	assert.InDelta(t, 2, cost.Total, 1e-9)
+}
+
+func TestTariffCheapestWindow(t *testing.T) {
+	tariff, err := LoadTariff(writeTemp(t, TariffJSON))
+	assert.Nil(t, err)
+
+	noon := time.Date(2020, 7, 1, 12, 0, 0, 0, time.UTC)
+	start, price, err := tariff.CheapestWindow(noon, noon.Add(24*time.Hour), 3*time.Hour)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2020, 7, 2, 0, 0, 0, 0, time.UTC), start)
+	assert.InDelta(t, 0.10, price, 1e-9)
+
+	// longer than off-peak hours, so the earliest of the equally cheap windows
+	evening := time.Date(2020, 7, 1, 20, 0, 0, 0, time.UTC)
+	start, price, err = tariff.CheapestWindow(evening, evening.Add(14*time.Hour), 8*time.Hour)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2020, 7, 1, 23, 0, 0, 0, time.UTC), start)
+	assert.InDelta(t, 0.1125, price, 1e-9)
+
+	_, _, err = tariff.CheapestWindow(evening, evening.Add(time.Hour), 2*time.Hour)
+	assert.NotNil(t, err)
+}
+
+// writeTemp writes the content to a temporary file removed when the test ends
+func writeTemp(t *testing.T, content string) string {
+	file, err := ioutil.TempFile("", "tesla")
+	assert.Nil(t, err)
+	t.Cleanup(func() { os.Remove(file.Name()) })
+	file.WriteString(content)
+	file.Close()
+	return file.Name()
+}
@@ -0,0 +1,198 @@
+package tesla
+
+import (
+	"time"
+)
+
+// metersPerMile converts between the miles reported by the vehicle and metric units
+const metersPerMile = 1609.344
+
+// Location is a point reported by a vehicle
+type Location struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// Trip is a drive detected from stream events. Distances are in miles and speeds
+// in miles per hour, as reported by the vehicle; elevation is in meters.
+type Trip struct {
+	Start         time.Time      `json:"start"`
+	End           time.Time      `json:"end"`
+	StartLocation *Location      `json:"start_location"`
+	EndLocation   *Location      `json:"end_location"`
+	Distance      float64        `json:"distance"`
+	EnergyUsed    float64        `json:"energy_used_kwh"`
+	AverageSpeed  float64        `json:"average_speed"`
+	MaxSpeed      float64        `json:"max_speed"`
+	ElevationGain float64        `json:"elevation_gain"`
+	StartSoc      *int           `json:"start_soc"`
+	EndSoc        *int           `json:"end_soc"`
+	Events        []*StreamEvent `json:"-"`
+
+	startOdometer *float64
+	endOdometer   *float64
+	gpsDistance   float64
+}
+
+// Duration of the trip
+func (t *Trip) Duration() time.Duration {
+	return t.End.Sub(t.Start)
+}
+
+// WhPerMile is the energy used per mile driven
+func (t *Trip) WhPerMile() float64 {
+	if t.Distance <= 0 {
+		return 0
+	}
+	return t.EnergyUsed * 1000 / t.Distance
+}
+
+// WhPerKm is the energy used per kilometer driven
+func (t *Trip) WhPerKm() float64 {
+	return t.WhPerMile() * 1000 / metersPerMile
+}
+
+// TripOptions configures trip detection
+type TripOptions struct {
+	// MaxGap ends a trip when no event arrives for this long; defaults to 10 minutes
+	MaxGap time.Duration
+	// MinDistance discards trips shorter than this many miles
+	MinDistance float64
+}
+
+// TripSegmenter groups stream events into trips. A trip starts when the vehicle
+// is shifted into drive, reverse or neutral and ends when it is shifted into
+// park, the shift state disappears or the stream goes quiet for too long.
+type TripSegmenter struct {
+	opts    TripOptions
+	current *Trip
+	last    *StreamEvent
+}
+
+var defaultTripMaxGap = 10 * time.Minute
+
+// NewTripSegmenter creates a segmenter with the given options
+func NewTripSegmenter(opts *TripOptions) *TripSegmenter {
+	s := &TripSegmenter{}
+	if opts != nil {
+		s.opts = *opts
+	}
+	if s.opts.MaxGap <= 0 {
+		s.opts.MaxGap = defaultTripMaxGap
+	}
+	return s
+}
+
+// DetectTrips reads events until the channel is closed and sends each trip detected
+func DetectTrips(events <-chan *StreamEvent, opts *TripOptions) <-chan *Trip {
+	trips := make(chan *Trip)
+	go func() {
+		defer close(trips)
+		s := NewTripSegmenter(opts)
+		for event := range events {
+			if trip := s.Add(event); trip != nil {
+				trips <- trip
+			}
+		}
+		if trip := s.Flush(); trip != nil {
+			trips <- trip
+		}
+	}()
+	return trips
+}
+
+// Add processes the next event, returning the trip it completes, if any
+func (s *TripSegmenter) Add(event *StreamEvent) *Trip {
+	var completed *Trip
+	if s.current != nil && s.last != nil && event.Timestamp.Sub(s.last.Timestamp) > s.opts.MaxGap {
+		completed = s.Flush()
+	}
+
+	if !isDriving(event) {
+		if s.current != nil {
+			s.extend(event)
+			completed = s.Flush()
+		}
+		s.last = event
+		return completed
+	}
+
+	if s.current == nil {
+		s.current = &Trip{Start: event.Timestamp}
+		s.last = nil
+	}
+	s.extend(event)
+	s.last = event
+	return completed
+}
+
+// Flush ends the trip in progress, returning it unless it is too short
+func (s *TripSegmenter) Flush() *Trip {
+	trip := s.current
+	s.current = nil
+	if trip == nil {
+		return nil
+	}
+	if trip.startOdometer != nil && trip.endOdometer != nil {
+		trip.Distance = *trip.endOdometer - *trip.startOdometer
+	} else {
+		trip.Distance = trip.gpsDistance / metersPerMile
+	}
+	if hours := trip.Duration().Hours(); hours > 0 {
+		trip.AverageSpeed = trip.Distance / hours
+	}
+	if trip.Distance < s.opts.MinDistance {
+		return nil
+	}
+	return trip
+}
+
+// extend adds the event to the current trip, accumulating energy, distance and elevation
+func (s *TripSegmenter) extend(event *StreamEvent) {
+	trip := s.current
+	trip.Events = append(trip.Events, event)
+	trip.End = event.Timestamp
+
+	if event.EstLat != nil && event.EstLng != nil {
+		location := &Location{Latitude: *event.EstLat, Longitude: *event.EstLng}
+		if trip.StartLocation == nil {
+			trip.StartLocation = location
+		} else if trip.EndLocation != nil {
+			trip.gpsDistance += distanceMeters(trip.EndLocation.Latitude, trip.EndLocation.Longitude, location.Latitude, location.Longitude)
+		}
+		trip.EndLocation = location
+	}
+	if event.Odometer != nil {
+		if trip.startOdometer == nil {
+			trip.startOdometer = event.Odometer
+		}
+		trip.endOdometer = event.Odometer
+	}
+	if event.Soc != nil {
+		if trip.StartSoc == nil {
+			trip.StartSoc = event.Soc
+		}
+		trip.EndSoc = event.Soc
+	}
+	if event.Speed != nil && float64(*event.Speed) > trip.MaxSpeed {
+		trip.MaxSpeed = float64(*event.Speed)
+	}
+
+	last := s.last
+	if last == nil {
+		return
+	}
+	if event.Power != nil && last.Power != nil {
+		// trapezoidal integration of power in kW over the time between events
+		hours := event.Timestamp.Sub(last.Timestamp).Hours()
+		trip.EnergyUsed += float64(*event.Power+*last.Power) / 2 * hours
+	}
+	if event.Elevation != nil && last.Elevation != nil && *event.Elevation > *last.Elevation {
+		trip.ElevationGain += float64(*event.Elevation - *last.Elevation)
+	}
+}
+
+// isDriving reports whether the event's shift state is anything but park
+func isDriving(event *StreamEvent) bool {
+	return event.ShiftState != nil && *event.ShiftState != "" && *event.ShiftState != "P"
+}
@@ -0,0 +1,105 @@
+package tesla
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var tripFields = []string{"speed", "odometer", "soc", "elevation", "est_lat", "est_lng", "power", "shift_state"}
+
+var tripLines = []string{
+	"1460905300000,0,1000.0,80,100,30.0,-100.0,0,P",
+	"1460905360000,0,1000.0,80,100,30.0,-100.0,0,D",
+	"1460905420000,30,1000.5,80,110,30.007,-100.0,20,D",
+	"1460905480000,60,1001.5,79,105,30.021,-100.0,40,D",
+	"1460905540000,30,1002.0,79,120,30.028,-100.0,-10,D",
+	"1460905600000,0,1002.0,79,120,30.028,-100.0,0,P",
+	"1460905660000,0,1002.0,79,120,30.028,-100.0,0,",
+	// a second, short trip
+	"1460906000000,5,1002.0,79,120,30.028,-100.0,5,R",
+	"1460906060000,0,1002.1,79,120,30.029,-100.0,0,P",
+}
+
+func tripEvents(t *testing.T) []*StreamEvent {
+	var events []*StreamEvent
+	for _, line := range tripLines {
+		event, err := parseStreamEvent(line, tripFields)
+		assert.Nil(t, err)
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestTripSegmenter(t *testing.T) {
+	segmenter := NewTripSegmenter(nil)
+	var trips []*Trip
+	for _, event := range tripEvents(t) {
+		if trip := segmenter.Add(event); trip != nil {
+			trips = append(trips, trip)
+		}
+	}
+	assert.Nil(t, segmenter.Flush())
+	assert.Len(t, trips, 2)
+
+	trip := trips[0]
+	assert.Equal(t, time.Unix(1460905360, 0), trip.Start)
+	assert.Equal(t, time.Unix(1460905600, 0), trip.End)
+	assert.Equal(t, 4*time.Minute, trip.Duration())
+	assert.Equal(t, &Location{Latitude: 30.0, Longitude: -100.0}, trip.StartLocation)
+	assert.Equal(t, &Location{Latitude: 30.028, Longitude: -100.0}, trip.EndLocation)
+	assert.InDelta(t, 2.0, trip.Distance, 1e-9)
+	assert.InDelta(t, 30.0, trip.AverageSpeed, 1e-9)
+	assert.Equal(t, 60.0, trip.MaxSpeed)
+	assert.Equal(t, 25.0, trip.ElevationGain)
+	assert.Equal(t, 80, *trip.StartSoc)
+	assert.Equal(t, 79, *trip.EndSoc)
+	// (10 + 30 + 15 - 5) kW averaged over one minute each
+	assert.InDelta(t, 50.0/60, trip.EnergyUsed, 1e-9)
+	assert.InDelta(t, 416.667, trip.WhPerMile(), 1e-3)
+	assert.InDelta(t, 258.904, trip.WhPerKm(), 1e-3)
+	assert.Len(t, trip.Events, 5)
+
+	assert.Equal(t, time.Unix(1460906000, 0), trips[1].Start)
+	assert.InDelta(t, 0.1, trips[1].Distance, 1e-9)
+
+	// short trips can be discarded
+	segmenter = NewTripSegmenter(&TripOptions{MinDistance: 0.5})
+	trips = nil
+	for _, event := range tripEvents(t) {
+		if trip := segmenter.Add(event); trip != nil {
+			trips = append(trips, trip)
+		}
+	}
+	assert.Len(t, trips, 1)
+	assert.InDelta(t, 2.0, trips[0].Distance, 1e-9)
+
+	// long gaps between events end a trip
+	segmenter = NewTripSegmenter(&TripOptions{MaxGap: 90 * time.Second})
+	trips = nil
+	events := tripEvents(t)
+	for _, event := range []*StreamEvent{events[1], events[2], events[4], events[5]} {
+		if trip := segmenter.Add(event); trip != nil {
+			trips = append(trips, trip)
+		}
+	}
+	assert.Len(t, trips, 2)
+	assert.InDelta(t, 0.5, trips[0].Distance, 1e-9)
+	assert.Equal(t, time.Unix(1460905420, 0), trips[0].End)
+	assert.Equal(t, time.Unix(1460905540, 0), trips[1].Start)
+
+	eventChan := make(chan *StreamEvent)
+	go func() {
+		for _, event := range tripEvents(t)[:4] {
+			eventChan <- event
+		}
+		close(eventChan)
+	}()
+	var detected []*Trip
+	for trip := range DetectTrips(eventChan, nil) {
+		detected = append(detected, trip)
+	}
+	assert.Len(t, detected, 1)
+	assert.InDelta(t, 1.5, detected[0].Distance, 1e-9)
+}
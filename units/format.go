@@ -0,0 +1,239 @@
+package units
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/billcobbler/tesla"
+)
+
+// quantity is the kind of value held by a field of a state struct
+type quantity int
+
+const (
+	distance quantity = iota + 1
+	temperature
+	speed
+	power
+	// elevation is a height above sea level in meters
+	elevation
+	// chargeRate is the range added per hour of charging, in miles per hour
+	chargeRate
+)
+
+// fieldQuantities maps the JSON names of fields in the state structs, stream
+// events and trips to the quantity they hold, in the units the API reports
+var fieldQuantities = map[string]quantity{
+	"battery_range":            distance,
+	"est_battery_range":        distance,
+	"ideal_battery_range":      distance,
+	"charge_miles_added_ideal": distance,
+	"charge_miles_added_rated": distance,
+	"odometer":                 distance,
+	"range":                    distance,
+	"est_range":                distance,
+	"distance":                 distance,
+	"charge_rate":              chargeRate,
+	"speed":                    speed,
+	"average_speed":            speed,
+	"max_speed":                speed,
+	"driver_temp_setting":      temperature,
+	"passenger_temp_setting":   temperature,
+	"inside_temp":              temperature,
+	"outside_temp":             temperature,
+	"max_avail_temp":           temperature,
+	"min_avail_temp":           temperature,
+	"charger_power":            power,
+	"power":                    power,
+	"elevation":                elevation,
+	"elevation_gain":           elevation,
+}
+
+// Formatter converts and formats quantities in the chosen systems of units
+type Formatter struct {
+	Distance    System
+	Temperature System
+}
+
+// NewFormatter returns a formatter using the system for every quantity
+func NewFormatter(system System) *Formatter {
+	return &Formatter{Distance: system, Temperature: system}
+}
+
+// ForGuiSettings returns a formatter using the units shown on the vehicle's display
+func ForGuiSettings(gui *tesla.GuiSettings) *Formatter {
+	f := NewFormatter(Imperial)
+	if strings.HasPrefix(gui.GuiDistanceUnits, "km") {
+		f.Distance = Metric
+	}
+	if gui.GuiTemperatureUnits == "C" {
+		f.Temperature = Metric
+	}
+	return f
+}
+
+// FormatDistance formats the distance in kilometers or miles
+func (f *Formatter) FormatDistance(d Distance) string {
+	if f.Distance == Metric {
+		return fmt.Sprintf("%.1f km", d.Kilometers())
+	}
+	return fmt.Sprintf("%.1f mi", d.Miles())
+}
+
+// FormatSpeed formats the speed in kilometers or miles per hour
+func (f *Formatter) FormatSpeed(s Speed) string {
+	if f.Distance == Metric {
+		return fmt.Sprintf("%.0f km/h", s.KilometersPerHour())
+	}
+	return fmt.Sprintf("%.0f mph", s.MilesPerHour())
+}
+
+// FormatElevation formats the elevation in meters or feet
+func (f *Formatter) FormatElevation(d Distance) string {
+	if f.Distance == Metric {
+		return fmt.Sprintf("%.0f m", d.Meters())
+	}
+	return fmt.Sprintf("%.0f ft", d.Feet())
+}
+
+// FormatChargeRate formats the range added per hour of charging in kilometers
+// or miles per hour, in the units the vehicle's display uses for it
+func (f *Formatter) FormatChargeRate(rate Speed) string {
+	if f.Distance == Metric {
+		return fmt.Sprintf("%.1f km/hr", rate.KilometersPerHour())
+	}
+	return fmt.Sprintf("%.1f mi/hr", rate.MilesPerHour())
+}
+
+// FormatTemperature formats the temperature in degrees Celsius or Fahrenheit
+func (f *Formatter) FormatTemperature(t Temperature) string {
+	if f.Temperature == Metric {
+		return fmt.Sprintf("%.1f °C", t.Celsius())
+	}
+	return fmt.Sprintf("%.1f °F", t.Fahrenheit())
+}
+
+// FormatPower formats the power in kilowatts, which both systems use
+func (f *Formatter) FormatPower(p Power) string {
+	return fmt.Sprintf("%.1f kW", p.Kilowatts())
+}
+
+// Convert returns the fields of a state struct, such as *tesla.ChargeState or
+// *tesla.StreamEvent, keyed by their JSON names. Distances, elevations, speeds,
+// charge rates and temperatures are converted to the formatter's units; other
+// fields, and those without a value, are returned as they are.
+func (f *Formatter) Convert(state interface{}) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	err := eachField(state, func(name string, value interface{}, q quantity, number float64, ok bool) {
+		if !ok {
+			fields[name] = value
+			return
+		}
+		fields[name] = f.convert(q, number)
+	})
+	return fields, err
+}
+
+// Format returns the fields of a state struct, keyed by their JSON names, as
+// text. Quantities include their units.
+func (f *Formatter) Format(state interface{}) (map[string]string, error) {
+	fields := map[string]string{}
+	err := eachField(state, func(name string, value interface{}, q quantity, number float64, ok bool) {
+		switch {
+		case !ok && value == nil:
+			fields[name] = ""
+		case !ok:
+			fields[name] = fmt.Sprint(value)
+		case q == distance:
+			fields[name] = f.FormatDistance(Miles(number))
+		case q == elevation:
+			fields[name] = f.FormatElevation(Meters(number))
+		case q == speed:
+			fields[name] = f.FormatSpeed(MilesPerHour(number))
+		case q == chargeRate:
+			fields[name] = f.FormatChargeRate(MilesPerHour(number))
+		case q == temperature:
+			fields[name] = f.FormatTemperature(Celsius(number))
+		case q == power:
+			fields[name] = f.FormatPower(Kilowatts(number))
+		}
+	})
+	return fields, err
+}
+
+// convert converts a value in the API's units to the formatter's units
+func (f *Formatter) convert(q quantity, number float64) float64 {
+	switch q {
+	case distance:
+		if f.Distance == Metric {
+			return Miles(number).Kilometers()
+		}
+	case elevation:
+		if f.Distance == Imperial {
+			return Meters(number).Feet()
+		}
+	case speed, chargeRate:
+		if f.Distance == Metric {
+			return MilesPerHour(number).KilometersPerHour()
+		}
+	case temperature:
+		if f.Temperature == Imperial {
+			return Celsius(number).Fahrenheit()
+		}
+	}
+	return number
+}
+
+// eachField calls fn with each exported field of the struct, the quantity it
+// holds and its numeric value. ok is false for fields that hold no quantity or
+// have no numeric value, such as nil pointers or the nulls the API returns.
+func eachField(state interface{}, fn func(name string, value interface{}, q quantity, number float64, ok bool)) error {
+	v := reflect.ValueOf(state)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return errors.New("nil state")
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return fmt.Errorf("%T is not a state struct", state)
+	}
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if field.PkgPath != "" || name == "" || name == "-" {
+			continue
+		}
+		value := indirect(v.Field(i))
+		q, isQuantity := fieldQuantities[name]
+		number, isNumber := numeric(value)
+		fn(name, value, q, number, isQuantity && isNumber)
+	}
+	return nil
+}
+
+// indirect returns the value of a field, or the value it points to, or nil if it points to nothing
+func indirect(v reflect.Value) interface{} {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	return v.Interface()
+}
+
+// numeric returns the value of a number
+func numeric(value interface{}) (float64, bool) {
+	switch n := value.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
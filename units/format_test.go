@@ -0,0 +1,64 @@
+package units
+
+import (
+	"testing"
+
+	"github.com/billcobbler/tesla"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatter(t *testing.T) {
+	gui := &tesla.GuiSettings{GuiDistanceUnits: "km/hr", GuiTemperatureUnits: "F"}
+	f := ForGuiSettings(gui)
+	assert.Equal(t, Metric, f.Distance)
+	assert.Equal(t, Imperial, f.Temperature)
+	assert.Equal(t, "160.9 km", f.FormatDistance(Miles(100)))
+	assert.Equal(t, "105 km/h", f.FormatSpeed(MilesPerHour(65)))
+	assert.Equal(t, "68.0 °F", f.FormatTemperature(Celsius(20)))
+	assert.Equal(t, "7.2 kW", f.FormatPower(Kilowatts(7.2)))
+	assert.Equal(t, "100 m", f.FormatElevation(Meters(100)))
+	assert.Equal(t, "48.3 km/hr", f.FormatChargeRate(MilesPerHour(30)))
+
+	charge := &tesla.ChargeState{BatteryRange: 200, ChargingState: "Charging", ChargerPower: 7.0, BatteryLevel: 80}
+	fields, err := NewFormatter(Metric).Convert(charge)
+	assert.Nil(t, err)
+	assert.InDelta(t, 321.8688, fields["battery_range"], 1e-9)
+	assert.Equal(t, "Charging", fields["charging_state"])
+	assert.Equal(t, 80, fields["battery_level"])
+	assert.Equal(t, 7.0, fields["charger_power"])
+	assert.Nil(t, fields["charger_voltage"])
+
+	// charge rates are range added per hour, not speeds
+	text, err := NewFormatter(Imperial).Format(&tesla.ChargeState{ChargeRate: 30})
+	assert.Nil(t, err)
+	assert.Equal(t, "30.0 mi/hr", text["charge_rate"])
+
+	climate := &tesla.ClimateState{InsideTemp: 21.5, IsClimateOn: true}
+	text, err = NewFormatter(Imperial).Format(climate)
+	assert.Nil(t, err)
+	assert.Equal(t, "70.7 °F", text["inside_temp"])
+	assert.Equal(t, "true", text["is_climate_on"])
+	assert.Equal(t, "", text["fan_status"])
+
+	speed, odometer := 65, 9550.3
+	event := &tesla.StreamEvent{Speed: &speed, Odometer: &odometer}
+	text, err = ForGuiSettings(gui).Format(event)
+	assert.Nil(t, err)
+	assert.Equal(t, "105 km/h", text["speed"])
+	assert.Equal(t, "15369.7 km", text["odometer"])
+	assert.Equal(t, "", text["power"])
+
+	elevation := 100
+	fields, err = NewFormatter(Imperial).Convert(&tesla.StreamEvent{Elevation: &elevation})
+	assert.Nil(t, err)
+	assert.InDelta(t, 328.084, fields["elevation"], 1e-3)
+	text, err = NewFormatter(Imperial).Format(&tesla.Trip{ElevationGain: 30})
+	assert.Nil(t, err)
+	assert.Equal(t, "98 ft", text["elevation_gain"])
+
+	_, err = f.Convert(42)
+	assert.NotNil(t, err)
+	var missing *tesla.DriveState
+	_, err = f.Format(missing)
+	assert.NotNil(t, err)
+}
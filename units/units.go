@@ -0,0 +1,132 @@
+// Package units converts the quantities reported by the Tesla API, which are
+// always in miles, miles per hour and degrees Celsius, with elevations in
+// meters, between metric and imperial units.
+package units
+
+const (
+	metersPerMile      = 1609.344
+	metersPerKilometer = 1000.0
+	metersPerFoot      = 0.3048
+)
+
+// Distance is a length in meters
+type Distance float64
+
+// Miles returns the distance of the given number of miles
+func Miles(mi float64) Distance {
+	return Distance(mi * metersPerMile)
+}
+
+// Kilometers returns the distance of the given number of kilometers
+func Kilometers(km float64) Distance {
+	return Distance(km * metersPerKilometer)
+}
+
+// Meters returns the distance of the given number of meters
+func Meters(m float64) Distance {
+	return Distance(m)
+}
+
+// Feet returns the distance of the given number of feet
+func Feet(ft float64) Distance {
+	return Distance(ft * metersPerFoot)
+}
+
+// Miles returns the distance in miles
+func (d Distance) Miles() float64 {
+	return float64(d) / metersPerMile
+}
+
+// Kilometers returns the distance in kilometers
+func (d Distance) Kilometers() float64 {
+	return float64(d) / metersPerKilometer
+}
+
+// Meters returns the distance in meters
+func (d Distance) Meters() float64 {
+	return float64(d)
+}
+
+// Feet returns the distance in feet
+func (d Distance) Feet() float64 {
+	return float64(d) / metersPerFoot
+}
+
+// Temperature is a temperature in degrees Celsius
+type Temperature float64
+
+// Celsius returns the temperature of the given degrees Celsius
+func Celsius(c float64) Temperature {
+	return Temperature(c)
+}
+
+// Fahrenheit returns the temperature of the given degrees Fahrenheit
+func Fahrenheit(f float64) Temperature {
+	return Temperature((f - 32) * 5 / 9)
+}
+
+// Celsius returns the temperature in degrees Celsius
+func (t Temperature) Celsius() float64 {
+	return float64(t)
+}
+
+// Fahrenheit returns the temperature in degrees Fahrenheit
+func (t Temperature) Fahrenheit() float64 {
+	return float64(t)*9/5 + 32
+}
+
+// Speed is a speed in meters per second
+type Speed float64
+
+// MilesPerHour returns the speed of the given miles per hour
+func MilesPerHour(mph float64) Speed {
+	return Speed(mph * metersPerMile / 3600)
+}
+
+// KilometersPerHour returns the speed of the given kilometers per hour
+func KilometersPerHour(kph float64) Speed {
+	return Speed(kph * metersPerKilometer / 3600)
+}
+
+// MilesPerHour returns the speed in miles per hour
+func (s Speed) MilesPerHour() float64 {
+	return float64(s) * 3600 / metersPerMile
+}
+
+// KilometersPerHour returns the speed in kilometers per hour
+func (s Speed) KilometersPerHour() float64 {
+	return float64(s) * 3600 / metersPerKilometer
+}
+
+// Power is a power in watts
+type Power float64
+
+// Kilowatts returns the power of the given kilowatts
+func Kilowatts(kw float64) Power {
+	return Power(kw * 1000)
+}
+
+// Kilowatts returns the power in kilowatts
+func (p Power) Kilowatts() float64 {
+	return float64(p) / 1000
+}
+
+// System is a system of units
+type System int
+
+const (
+	// Imperial uses miles, miles per hour and degrees Fahrenheit
+	Imperial System = iota
+	// Metric uses kilometers, kilometers per hour and degrees Celsius
+	Metric
+)
+
+func (s System) String() string {
+	switch s {
+	case Imperial:
+		return "imperial"
+	case Metric:
+		return "metric"
+	}
+	return "unknown"
+}
@@ -0,0 +1,22 @@
+package units
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnits(t *testing.T) {
+	assert.InDelta(t, 160.9344, Miles(100).Kilometers(), 1e-9)
+	assert.InDelta(t, 62.1371, Kilometers(100).Miles(), 1e-4)
+	assert.InDelta(t, 68, Celsius(20).Fahrenheit(), 1e-9)
+	assert.InDelta(t, 20, Fahrenheit(68).Celsius(), 1e-9)
+	assert.InDelta(t, 104.607, MilesPerHour(65).KilometersPerHour(), 1e-3)
+	assert.InDelta(t, 65, KilometersPerHour(MilesPerHour(65).KilometersPerHour()).MilesPerHour(), 1e-9)
+	assert.InDelta(t, 27.7778, float64(KilometersPerHour(100)), 1e-4)
+	assert.Equal(t, 11.5, Kilowatts(11.5).Kilowatts())
+	assert.InDelta(t, 328.084, Meters(100).Feet(), 1e-3)
+	assert.InDelta(t, 100, Feet(Meters(100).Feet()).Meters(), 1e-9)
+	assert.Equal(t, "metric", Metric.String())
+	assert.Equal(t, "imperial", Imperial.String())
+}
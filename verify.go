@@ -0,0 +1,107 @@
+package tesla
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// VerifyOptions configures how commands are verified by re-reading the vehicle's state
+// after the Tesla API reports success
+type VerifyOptions struct {
+	// Interval between state polls
+	Interval time.Duration
+	// Timeout after which the command is reported as not verified
+	Timeout time.Duration
+}
+
+// ErrNotVerified is returned when the expected state did not appear before the verify timeout
+var ErrNotVerified = errors.New("command not verified")
+
+var (
+	defaultVerifyInterval = 2 * time.Second
+	defaultVerifyTimeout  = 30 * time.Second
+)
+
+// verifyCommand polls the vehicle's state until the command's verify check passes,
+// the timeout elapses or ctx is done
+func (v Vehicle) verifyCommand(ctx context.Context, cmd Command, payload interface{}, opts *VerifyOptions) error {
+	interval, timeout := defaultVerifyInterval, defaultVerifyTimeout
+	if opts.Interval > 0 {
+		interval = opts.Interval
+	}
+	if opts.Timeout > 0 {
+		timeout = opts.Timeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		ok, err := cmd.verify(v, payload)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %s after %v", ErrNotVerified, cmd.Name, timeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+// verifyClimate checks whether the climate system is on or off
+func verifyClimate(on bool) func(Vehicle, interface{}) (bool, error) {
+	return func(v Vehicle, payload interface{}) (bool, error) {
+		climateState, err := v.ClimateState()
+		if err != nil {
+			return false, err
+		}
+		return climateState.IsClimateOn == on, nil
+	}
+}
+
+// verifyCharging checks whether the vehicle is charging or not
+func verifyCharging(charging bool) func(Vehicle, interface{}) (bool, error) {
+	return func(v Vehicle, payload interface{}) (bool, error) {
+		chargeState, err := v.ChargeState()
+		if err != nil {
+			return false, err
+		}
+		return (chargeState.ChargingState == "Charging") == charging, nil
+	}
+}
+
+// verifyChargeLimit checks the charge limit matches the requested percent
+func verifyChargeLimit(v Vehicle, payload interface{}) (bool, error) {
+	chargeState, err := v.ChargeState()
+	if err != nil {
+		return false, err
+	}
+	return chargeState.ChargeLimitSoc == payload.(*ChargeLimitRequest).Percent, nil
+}
+
+// verifyChargingAmps checks the requested charging current matches the requested amps
+func verifyChargingAmps(v Vehicle, payload interface{}) (bool, error) {
+	chargeState, err := v.ChargeState()
+	if err != nil {
+		return false, err
+	}
+	return chargeState.ChargeCurrentRequest == payload.(*ChargingAmpsRequest).ChargingAmps, nil
+}
+
+// verifyLocked checks whether the doors are locked or unlocked
+func verifyLocked(locked bool) func(Vehicle, interface{}) (bool, error) {
+	return func(v Vehicle, payload interface{}) (bool, error) {
+		vehicleState, err := v.VehicleState()
+		if err != nil {
+			return false, err
+		}
+		return vehicleState.Locked == locked, nil
+	}
+}
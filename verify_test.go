@@ -0,0 +1,56 @@
+package tesla
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerify(t *testing.T) {
+	ts := serveHTTP(t)
+	defer ts.Close()
+	previousURL := BaseURL
+	BaseURL = ts.URL + "/api/1"
+
+	auth := &Auth{
+		GrantType:    "password",
+		ClientID:     "someclient123",
+		ClientSecret: "somesecret456",
+		Email:        "nobody@example.com",
+		Password:     "pass",
+	}
+	client, _ := NewClient(auth)
+	client.Verify = &VerifyOptions{
+		Interval: 5 * time.Millisecond,
+		Timeout:  20 * time.Millisecond,
+	}
+	vehicles, err := client.Vehicles()
+	assert.Nil(t, err)
+	vehicle := vehicles[0]
+
+	err = vehicle.LockDoors()
+	assert.Nil(t, err)
+
+	err = vehicle.UnlockDoors()
+	assert.True(t, errors.Is(err, ErrNotVerified))
+
+	err = vehicle.SetChargeLimit(50)
+	assert.True(t, errors.Is(err, ErrNotVerified))
+
+	err = vehicle.StopCharging()
+	assert.Nil(t, err)
+
+	err = vehicle.StopAirConditioning()
+	assert.Nil(t, err)
+
+	err = vehicle.StartAirConditioning()
+	assert.Equal(t, "command not verified: auto_conditioning_start after 20ms", err.Error())
+
+	// commands without a verify check are unaffected
+	err = vehicle.FlashLights()
+	assert.Nil(t, err)
+
+	BaseURL = previousURL
+}
@@ -0,0 +1,232 @@
+package tesla
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// WatchOptions configures a watcher. Intervals that are not set use their defaults.
+type WatchOptions struct {
+	// ActiveInterval is the delay between polls while the vehicle is driving or charging; defaults to 15 seconds
+	ActiveInterval time.Duration
+	// IdleInterval caps the delay between polls while the vehicle is parked, which
+	// doubles after each poll starting from ActiveInterval; defaults to 5 minutes
+	IdleInterval time.Duration
+	// SleepInterval is the delay between polls of the vehicle list while the
+	// vehicle is asleep, offline or being left alone; defaults to 1 minute
+	SleepInterval time.Duration
+	// SleepAfter is how long the vehicle may stay parked before the watcher stops
+	// fetching its state so it can fall asleep; defaults to 15 minutes
+	SleepAfter time.Duration
+	// SleepWindow is how long the vehicle is left alone before its state is
+	// fetched again if it has not fallen asleep; defaults to 30 minutes
+	SleepWindow time.Duration
+}
+
+// WatchSnapshot is the result of a single poll. The vehicle's states are nil
+// unless it was online and they were fetched.
+type WatchSnapshot struct {
+	Time         time.Time
+	State        string
+	ChargeState  *ChargeState
+	ClimateState *ClimateState
+	DriveState   *DriveState
+	VehicleState *VehicleState
+	// Resting is true while the watcher leaves the vehicle alone so it can fall asleep
+	Resting bool
+}
+
+// Watcher polls a vehicle without keeping it awake. The vehicle list, which
+// does not wake vehicles, is polled first and the vehicle's states are only
+// fetched, with a single vehicle_data request, when it is online. Polling is
+// fast while the vehicle is driving or charging, backs off while it is parked,
+// and stops fetching state once it has been parked for a while so the vehicle
+// can fall asleep.
+//
+// Snapshots must be read for the watcher to make progress. Errors is buffered
+// and dropped if not read. Both channels are closed once the watcher is closed.
+type Watcher struct {
+	Snapshots chan *WatchSnapshot
+	Errors    chan error
+
+	vehicle   Vehicle
+	opts      WatchOptions
+	done      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+
+	interval     time.Duration
+	parkedSince  time.Time
+	restingSince time.Time
+}
+
+var (
+	defaultActiveInterval = 15 * time.Second
+	defaultIdleInterval   = 5 * time.Minute
+	defaultSleepInterval  = time.Minute
+	defaultSleepAfter     = 15 * time.Minute
+	defaultSleepWindow    = 30 * time.Minute
+)
+
+// Watch starts a watcher polling the vehicle
+func (v Vehicle) Watch(opts *WatchOptions) *Watcher {
+	w := &Watcher{
+		Snapshots: make(chan *WatchSnapshot),
+		Errors:    make(chan error, 16),
+		vehicle:   v,
+		done:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	if opts != nil {
+		w.opts = *opts
+	}
+	if w.opts.ActiveInterval <= 0 {
+		w.opts.ActiveInterval = defaultActiveInterval
+	}
+	if w.opts.IdleInterval < w.opts.ActiveInterval {
+		w.opts.IdleInterval = defaultIdleInterval
+	}
+	if w.opts.SleepInterval <= 0 {
+		w.opts.SleepInterval = defaultSleepInterval
+	}
+	if w.opts.SleepAfter <= 0 {
+		w.opts.SleepAfter = defaultSleepAfter
+	}
+	if w.opts.SleepWindow <= 0 {
+		w.opts.SleepWindow = defaultSleepWindow
+	}
+	w.interval = w.opts.ActiveInterval
+	go w.run()
+	return w
+}
+
+// Close stops the watcher and waits for it to finish
+func (w *Watcher) Close() {
+	w.closeOnce.Do(func() {
+		close(w.done)
+	})
+	<-w.stopped
+}
+
+func (w *Watcher) run() {
+	defer func() {
+		close(w.Snapshots)
+		close(w.Errors)
+		close(w.stopped)
+	}()
+
+	for {
+		snapshot, err := w.poll(time.Now())
+		if err != nil {
+			w.report(err)
+		}
+		if snapshot != nil {
+			select {
+			case w.Snapshots <- snapshot:
+			case <-w.done:
+				return
+			}
+		}
+
+		select {
+		case <-w.done:
+			return
+		case <-time.After(w.interval):
+		}
+	}
+}
+
+// poll checks the vehicle's state and, when it is online and not being left
+// alone, fetches its states. It sets the delay before the next poll.
+func (w *Watcher) poll(now time.Time) (*WatchSnapshot, error) {
+	vehicle, err := w.lookup()
+	if err != nil {
+		w.backoff()
+		return nil, err
+	}
+	w.vehicle = *vehicle
+	snapshot := &WatchSnapshot{Time: now, State: vehicle.State}
+
+	if vehicle.State != "online" {
+		w.parkedSince = time.Time{}
+		w.restingSince = time.Time{}
+		w.interval = w.opts.SleepInterval
+		return snapshot, nil
+	}
+	if !w.restingSince.IsZero() && now.Sub(w.restingSince) < w.opts.SleepWindow {
+		snapshot.Resting = true
+		w.interval = w.opts.SleepInterval
+		return snapshot, nil
+	}
+	w.restingSince = time.Time{}
+
+	data, err := vehicle.Data()
+	if err != nil {
+		w.backoff()
+		return snapshot, err
+	}
+	snapshot.ChargeState = data.ChargeState
+	snapshot.ClimateState = data.ClimateState
+	snapshot.DriveState = data.DriveState
+	snapshot.VehicleState = data.VehicleState
+
+	if isActive(data.ChargeState, data.DriveState) {
+		w.parkedSince = time.Time{}
+		w.interval = w.opts.ActiveInterval
+		return snapshot, nil
+	}
+	if w.parkedSince.IsZero() {
+		w.parkedSince = now
+		w.interval = w.opts.ActiveInterval
+	} else {
+		w.backoff()
+	}
+	if now.Sub(w.parkedSince) >= w.opts.SleepAfter {
+		w.parkedSince = time.Time{}
+		w.restingSince = now
+		w.interval = w.opts.SleepInterval
+	}
+	return snapshot, nil
+}
+
+// lookup finds the vehicle in the account's vehicle list, which does not wake it
+func (w *Watcher) lookup() (*Vehicle, error) {
+	vehicles, err := ActiveClient.Vehicles()
+	if err != nil {
+		return nil, err
+	}
+	for _, vehicle := range vehicles {
+		if vehicle.ID == w.vehicle.ID {
+			return vehicle.Vehicle, nil
+		}
+	}
+	return nil, errors.New("vehicle not found while watching")
+}
+
+// backoff doubles the delay before the next poll, up to the idle interval
+func (w *Watcher) backoff() {
+	w.interval *= 2
+	if w.interval > w.opts.IdleInterval {
+		w.interval = w.opts.IdleInterval
+	}
+}
+
+func (w *Watcher) report(err error) {
+	select {
+	case w.Errors <- err:
+	default:
+	}
+}
+
+// isActive reports whether the vehicle is charging or out of park
+func isActive(chargeState *ChargeState, driveState *DriveState) bool {
+	if chargeState != nil && chargeState.ChargingState == "Charging" {
+		return true
+	}
+	if driveState != nil {
+		shift := shiftState(driveState)
+		return shift != "" && shift != "P"
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package tesla
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatcher(t *testing.T) {
+	var mu sync.Mutex
+	state, chargingState := "online", "Charging"
+	var fetches int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch req.URL.Path {
+		case "/oauth/token":
+			w.Write([]byte(`{"access_token": "sometoken123"}`))
+		case "/api/1/vehicles":
+			w.Write([]byte(strings.Replace(VehiclesJSON, `"state":"online"`, `"state":"`+state+`"`, 1)))
+		case "/api/1/vehicles/123/vehicle_data":
+			fetches++
+			w.Write([]byte(strings.Replace(VehicleDataJSON, `"charging_state":"Complete"`, `"charging_state":"`+chargingState+`"`, 1)))
+		}
+	}))
+	defer ts.Close()
+	previousURL := BaseURL
+	BaseURL = ts.URL + "/api/1"
+	defer func() { BaseURL = previousURL }()
+
+	auth := &Auth{
+		GrantType:    "password",
+		ClientID:     "someclient123",
+		ClientSecret: "somesecret456",
+		Email:        "nobody@example.com",
+		Password:     "pass",
+	}
+	NewClient(auth)
+	vehicle := Vehicle{ID: 123}
+
+	// poll is driven directly with a fake clock to check the intervals chosen
+	w := &Watcher{vehicle: vehicle}
+	w.opts = WatchOptions{
+		ActiveInterval: 10 * time.Second,
+		IdleInterval:   time.Minute,
+		SleepInterval:  30 * time.Second,
+		SleepAfter:     10 * time.Minute,
+		SleepWindow:    20 * time.Minute,
+	}
+	start := time.Unix(1460905367, 0)
+
+	snapshot, err := w.poll(start)
+	assert.Nil(t, err)
+	assert.Equal(t, "online", snapshot.State)
+	assert.Equal(t, "Charging", snapshot.ChargeState.ChargingState)
+	assert.NotNil(t, snapshot.ClimateState)
+	assert.NotNil(t, snapshot.DriveState)
+	assert.Equal(t, "Macak", snapshot.VehicleState.VehicleName)
+	assert.Equal(t, 10*time.Second, w.interval)
+
+	mu.Lock()
+	chargingState = "Complete"
+	mu.Unlock()
+	w.poll(start.Add(time.Minute))
+	assert.Equal(t, 10*time.Second, w.interval)
+	w.poll(start.Add(2 * time.Minute))
+	assert.Equal(t, 20*time.Second, w.interval)
+	w.poll(start.Add(3 * time.Minute))
+	w.poll(start.Add(4 * time.Minute))
+	assert.Equal(t, time.Minute, w.interval)
+
+	// parked long enough: stop fetching state so the vehicle can sleep
+	snapshot, _ = w.poll(start.Add(11 * time.Minute))
+	assert.False(t, snapshot.Resting)
+	assert.Equal(t, 30*time.Second, w.interval)
+	assert.Equal(t, 6, fetches)
+	snapshot, _ = w.poll(start.Add(20 * time.Minute))
+	assert.True(t, snapshot.Resting)
+	assert.Nil(t, snapshot.ChargeState)
+	assert.Nil(t, snapshot.VehicleState)
+	assert.Equal(t, 6, fetches)
+
+	mu.Lock()
+	state = "asleep"
+	mu.Unlock()
+	snapshot, _ = w.poll(start.Add(25 * time.Minute))
+	assert.Equal(t, "asleep", snapshot.State)
+	assert.False(t, snapshot.Resting)
+	assert.Nil(t, snapshot.ChargeState)
+	assert.Equal(t, 6, fetches)
+
+	// woken by someone else: state is fetched again right away
+	mu.Lock()
+	state = "online"
+	mu.Unlock()
+	snapshot, _ = w.poll(start.Add(40 * time.Minute))
+	assert.NotNil(t, snapshot.ChargeState)
+	assert.Equal(t, 7, fetches)
+	assert.Equal(t, 10*time.Second, w.interval)
+
+	watcher := vehicle.Watch(&WatchOptions{ActiveInterval: time.Millisecond})
+	defer watcher.Close()
+	select {
+	case snapshot := <-watcher.Snapshots:
+		assert.Equal(t, "online", snapshot.State)
+		assert.Equal(t, 90, snapshot.ChargeState.BatteryLevel)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for a snapshot")
+	}
+	watcher.Close()
+	_, ok := <-watcher.Snapshots
+	assert.False(t, ok)
+}
@@ -0,0 +1,101 @@
+package tesla
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// StreamWebSocketURL is the endpoint of the websocket streaming API
+var StreamWebSocketURL = "wss://streaming.vn.teslamotors.com/streaming/"
+
+// streamMessage is a message exchanged with the websocket streaming API
+type streamMessage struct {
+	MsgType           string `json:"msg_type"`
+	Token             string `json:"token,omitempty"`
+	Value             string `json:"value,omitempty"`
+	Tag               string `json:"tag,omitempty"`
+	ErrorType         string `json:"error_type,omitempty"`
+	ConnectionTimeout int    `json:"connection_timeout,omitempty"`
+}
+
+// StreamDisconnectError is returned when the websocket streaming API reports an
+// error for the subscription, such as the vehicle disconnecting
+type StreamDisconnectError struct {
+	// Type is the API's error type: vehicle_disconnected, vehicle_error or client_error
+	Type string
+	// Value is the API's description of the error
+	Value string
+}
+
+func (e *StreamDisconnectError) Error() string {
+	return fmt.Sprintf("stream %s: %s", e.Type, e.Value)
+}
+
+// wsStreamConn reads events from a websocket streaming subscription
+type wsStreamConn struct {
+	conn *websocket.Conn
+}
+
+// ReadLine returns the value of the next data update, skipping control messages
+func (c *wsStreamConn) ReadLine() (string, error) {
+	for {
+		message := &streamMessage{}
+		if err := c.conn.ReadJSON(message); err != nil {
+			return "", err
+		}
+		switch message.MsgType {
+		case "data:update":
+			return message.Value, nil
+		case "data:error":
+			return "", &StreamDisconnectError{Type: message.ErrorType, Value: message.Value}
+		}
+	}
+}
+
+// Close closes the websocket connection
+func (c *wsStreamConn) Close() error {
+	return c.conn.Close()
+}
+
+// StreamWebSocket starts a stream from the vehicle over the websocket streaming
+// API, authenticating with the client's OAuth token. Events contain the given
+// fields, or those in StreamParams when none are given. The channels behave as
+// those returned by Stream.
+func (v Vehicle) StreamWebSocket(fields ...string) (chan *StreamEvent, chan error, error) {
+	fields = streamFields(fields)
+	conn, err := v.dialWebSocketStream(fields)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	eventChan := make(chan *StreamEvent)
+	errChan := make(chan error, 1)
+	go readStream(conn, fields, eventChan, errChan)
+
+	return eventChan, errChan, nil
+}
+
+// dialWebSocketStream connects to the websocket streaming API and subscribes to the vehicle's fields
+func (v Vehicle) dialWebSocketStream(fields []string) (*wsStreamConn, error) {
+	if ActiveClient.Token == nil {
+		return nil, ErrStreamUnauthorized
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(StreamWebSocketURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	subscribe := &streamMessage{
+		MsgType: "data:subscribe_oauth",
+		Token:   ActiveClient.Token.AccessToken,
+		Value:   strings.Join(fields, ","),
+		Tag:     strconv.Itoa(v.VehicleID),
+	}
+	if err = conn.WriteJSON(subscribe); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsStreamConn{conn: conn}, nil
+}
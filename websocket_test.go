@@ -0,0 +1,92 @@
+package tesla
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// serveWebSocket stands in for the websocket streaming API, sending two updates
+// followed by a vehicle disconnect to each subscriber
+func serveWebSocket(t *testing.T) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		conn, err := upgrader.Upgrade(w, req, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		subscribe := &streamMessage{}
+		assert.Nil(t, conn.ReadJSON(subscribe))
+		assert.Equal(t, "data:subscribe_oauth", subscribe.MsgType)
+		assert.Equal(t, "sometoken123", subscribe.Token)
+		assert.Equal(t, "456", subscribe.Tag)
+		assert.Equal(t, StreamParams, subscribe.Value)
+
+		conn.WriteJSON(&streamMessage{MsgType: "control:hello", ConnectionTimeout: 30000})
+		conn.WriteJSON(&streamMessage{MsgType: "data:update", Tag: "456", Value: "1460905367000,65,9550.3,88,10,76,30.493001,-100.457018,12,D,227,184,75"})
+		conn.WriteJSON(&streamMessage{MsgType: "data:update", Tag: "456", Value: "1460905368000,66,9550.4,88,10,76,30.493001,-100.457018,12,D,227,184,75"})
+		conn.WriteJSON(&streamMessage{MsgType: "data:error", Tag: "456", Value: "disconnected", ErrorType: "vehicle_disconnected"})
+		conn.ReadMessage()
+	}))
+}
+
+func TestStreamWebSocket(t *testing.T) {
+	ts := serveHTTP(t)
+	defer ts.Close()
+	ws := serveWebSocket(t)
+	defer ws.Close()
+	previousURL := BaseURL
+	BaseURL = ts.URL + "/api/1"
+	previousWebSocketURL := StreamWebSocketURL
+	StreamWebSocketURL = "ws" + strings.TrimPrefix(ws.URL, "http") + "/streaming/"
+
+	auth := &Auth{
+		GrantType:    "password",
+		ClientID:     "someclient123",
+		ClientSecret: "somesecret456",
+		Email:        "nobody@example.com",
+		Password:     "pass",
+	}
+	NewClient(auth)
+	vehicle := Vehicle{ID: 123, VehicleID: 456}
+
+	eventChan, errChan, err := vehicle.StreamWebSocket()
+	assert.Nil(t, err)
+	event := <-eventChan
+	assert.Equal(t, 65, *event.Speed)
+	event = <-eventChan
+	assert.Equal(t, 66, *event.Speed)
+	err = <-errChan
+	disconnectErr, ok := err.(*StreamDisconnectError)
+	assert.True(t, ok)
+	assert.Equal(t, "vehicle_disconnected", disconnectErr.Type)
+	assert.Equal(t, "stream vehicle_disconnected: disconnected", err.Error())
+
+	// the managed stream reconnects after the vehicle disconnects without repeating events
+	stream := vehicle.ManagedStream(&StreamOptions{Transport: StreamWebSocket, MinBackoff: time.Millisecond})
+	event = <-stream.Events
+	assert.Equal(t, 65, *event.Speed)
+	event = <-stream.Events
+	assert.Equal(t, 66, *event.Speed)
+	for change := range stream.States {
+		if change.State == StreamDisconnected {
+			assert.IsType(t, &StreamDisconnectError{}, change.Err)
+			break
+		}
+	}
+	select {
+	case event = <-stream.Events:
+		t.Fatalf("unexpected repeated event %v", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+	stream.Close()
+
+	BaseURL = previousURL
+	StreamWebSocketURL = previousWebSocketURL
+}